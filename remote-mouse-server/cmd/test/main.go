@@ -1,21 +1,36 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/tommyalmeida/remote-mouse/mouse"
+	"github.com/tommyalmeida/remote-mouse/mouse/native"
 )
 
 func main() {
+	backendName := flag.String("backend", "",
+		"mouse backend to test ("+strings.Join(native.Available(), ", ")+"), empty for the platform default")
+	flag.Parse()
+
 	fmt.Println("Testing native mouse implementation...")
+
+	backend, err := native.Open(*backendName)
+	if err != nil {
+		fmt.Println("Error opening backend:", err)
+		os.Exit(1)
+	}
+	defer backend.Close()
 	
-	// Get screen size
+	// Create controller with default config
 	config := mouse.DefaultConfig()
-	fmt.Printf("Screen size: %dx%d\n", config.ScreenWidth(), config.ScreenHeight())
+	ctrl := mouse.NewController(config, backend)
 	
-	// Create controller with default config
-	ctrl := mouse.NewController(nil)
+	// Get screen size
+	fmt.Printf("Screen size: %dx%d\n", config.ScreenWidth(), config.ScreenHeight())
 	
 	// Wait 2 seconds before starting
 	fmt.Println("Starting in 2 seconds...")
@@ -48,5 +63,13 @@ func main() {
 	ctrl.Click(mouse.DoubleClick)
 	time.Sleep(1 * time.Second)
 	
+	// The virtual backend records everything it was asked to do
+	if virtual, ok := backend.(*native.Virtual); ok {
+		fmt.Println("Recorded events:")
+		for i, event := range virtual.Events() {
+			fmt.Printf("%3d: %s\n", i, event)
+		}
+	}
+	
 	fmt.Println("Test completed!")
 } 
\ No newline at end of file
@@ -0,0 +1,422 @@
+// Package config holds the settings of the server binary. They come from
+// defaults, an optional JSON file, REMOTE_MOUSE_* environment variables
+// and command-line flags, each overriding the ones before.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tommyalmeida/remote-mouse/mouse"
+	"github.com/tommyalmeida/remote-mouse/mouse/native"
+	"github.com/tommyalmeida/remote-mouse/server"
+)
+
+// EnvPrefix starts the name of every environment variable, e.g.
+// REMOTE_MOUSE_PORT sets "port"
+const EnvPrefix = "REMOTE_MOUSE_"
+
+// Log levels
+const (
+	// LogError only logs errors
+	LogError = "error"
+	// LogInfo also logs connections and setting changes
+	LogInfo = "info"
+	// LogDebug also logs every event injected
+	LogDebug = "debug"
+)
+
+// Config holds the server settings. The JSON keys, flag names and setting
+// keys are the same.
+type Config struct {
+	// Host is the address to listen on, empty for every interface
+	Host string `json:"host"`
+	Port int    `json:"port"`
+	// IPv6 also accepts IPv6 connections, otherwise only IPv4 ones
+	IPv6 bool `json:"ipv6"`
+	// Static is the directory served next to the WebSocket endpoint
+	Static string `json:"static"`
+	// Backend is the name of the input backend, empty picks the platform's
+	Backend  string `json:"backend"`
+	LogLevel string `json:"log-level"`
+
+	UDP         string   `json:"udp"`
+	NoPairing   bool     `json:"no-pairing"`
+	TLS         bool     `json:"tls"`
+	Cert        string   `json:"cert"`
+	Key         string   `json:"key"`
+	AllowNet    string   `json:"allow-net"`
+	AllowOrigin string   `json:"allow-origin"`
+	Control     string   `json:"control"`
+	IdleTimeout Duration `json:"idle-timeout"`
+
+	Speed         float64 `json:"speed"`
+	Bounds        bool    `json:"bounds"`
+	Accel         string  `json:"accel"`
+	Stabilization bool    `json:"stabilization"`
+	DeadZone      int     `json:"deadzone"`
+	Smoothing     float64 `json:"smoothing"`
+	Jiggle        bool    `json:"jiggle"`
+	Drift         bool    `json:"drift"`
+}
+
+// Duration is a time.Duration written like "30s" in the file and on the
+// command line
+type Duration time.Duration
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d *Duration) Set(value string) error {
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = Duration(duration)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return fmt.Errorf("expected a duration like \"30s\", got %s", data)
+	}
+
+	return d.Set(text)
+}
+
+// Default returns the settings used when nothing else sets them
+func Default() *Config {
+	stabilization := mouse.DefaultStabilizationOptions()
+
+	return &Config{
+		Port:          8080,
+		IPv6:          true,
+		Static:        ".",
+		LogLevel:      LogDebug,
+		Control:       "first-wins",
+		IdleTimeout:   Duration(30 * time.Second),
+		Speed:         1,
+		Bounds:        true,
+		Accel:         "linear",
+		Stabilization: true,
+		DeadZone:      stabilization.DeadZone,
+		Smoothing:     stabilization.SmoothingLevel,
+		Jiggle:        stabilization.JiggleFilter,
+		Drift:         stabilization.AntiDrift,
+	}
+}
+
+// DefaultPath returns where the config file is looked for when none is given
+func DefaultPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "remote-mouse", "config.json"), nil
+}
+
+// Load returns the defaults overridden by the file at path, the
+// environment and then overrides, which maps setting keys to values.
+// An empty path reads the file at DefaultPath if there is one.
+func Load(path string, overrides map[string]string) (*Config, error) {
+	config := Default()
+
+	if path == "" {
+		if path, _ = DefaultPath(); path != "" {
+			if _, err := os.Stat(path); err != nil {
+				path = ""
+			}
+		}
+	}
+	if path != "" {
+		if err := config.LoadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := config.LoadEnv(); err != nil {
+		return nil, err
+	}
+
+	for key, value := range overrides {
+		if err := config.Set(key, value); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// LoadFile sets the settings the JSON file at path has, keeping the others
+func (c *Config) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(c); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// LoadEnv sets the settings that have an environment variable
+func (c *Config) LoadEnv() error {
+	for _, key := range Keys() {
+		name := EnvName(key)
+		if value, ok := os.LookupEnv(name); ok {
+			if err := c.Set(key, value); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// EnvName returns the environment variable setting key
+func EnvName(key string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(key, "-", "_"))
+}
+
+// keys lists every setting key
+var keys = []string{
+	"host", "port", "ipv6", "static", "backend", "log-level",
+	"udp", "no-pairing", "tls", "cert", "key", "allow-net", "allow-origin", "control", "idle-timeout",
+	"speed", "bounds", "accel", "stabilization", "deadzone", "smoothing", "jiggle", "drift",
+}
+
+// Keys returns every setting key
+func Keys() []string {
+	return slices.Clone(keys)
+}
+
+// Set parses value into the setting with the given key
+func (c *Config) Set(key, value string) error {
+	var err error
+
+	switch key {
+	case "host":
+		c.Host = value
+	case "port":
+		c.Port, err = strconv.Atoi(value)
+	case "ipv6":
+		c.IPv6, err = strconv.ParseBool(value)
+	case "static":
+		c.Static = value
+	case "backend":
+		c.Backend = value
+	case "log-level":
+		c.LogLevel = value
+	case "udp":
+		c.UDP = value
+	case "no-pairing":
+		c.NoPairing, err = strconv.ParseBool(value)
+	case "tls":
+		c.TLS, err = strconv.ParseBool(value)
+	case "cert":
+		c.Cert = value
+	case "key":
+		c.Key = value
+	case "allow-net":
+		c.AllowNet = value
+	case "allow-origin":
+		c.AllowOrigin = value
+	case "control":
+		c.Control = value
+	case "idle-timeout":
+		err = c.IdleTimeout.Set(value)
+	case "speed":
+		c.Speed, err = strconv.ParseFloat(value, 64)
+	case "bounds":
+		c.Bounds, err = strconv.ParseBool(value)
+	case "accel":
+		c.Accel = value
+	case "stabilization":
+		c.Stabilization, err = strconv.ParseBool(value)
+	case "deadzone":
+		c.DeadZone, err = strconv.Atoi(value)
+	case "smoothing":
+		c.Smoothing, err = strconv.ParseFloat(value, 64)
+	case "jiggle":
+		c.Jiggle, err = strconv.ParseBool(value)
+	case "drift":
+		c.Drift, err = strconv.ParseBool(value)
+	default:
+		return fmt.Errorf("unknown setting: %s", key)
+	}
+
+	if err != nil {
+		return fmt.Errorf("invalid value for %s: %q", key, value)
+	}
+	return nil
+}
+
+// Validate checks every setting
+func (c *Config) Validate() error {
+	if c.Port < 1 || c.Port > math.MaxUint16 {
+		return fmt.Errorf("port must be between 1 and %d, got %d", math.MaxUint16, c.Port)
+	}
+	if c.Host != "" && !c.IPv6 {
+		if ip := net.ParseIP(c.Host); ip != nil && ip.To4() == nil {
+			return fmt.Errorf("host %s is an IPv6 address but ipv6 is off", c.Host)
+		}
+	}
+	if c.Backend != "" && !slices.Contains(native.Available(), c.Backend) {
+		return fmt.Errorf("unknown backend %q (available: %v)", c.Backend, native.Available())
+	}
+	if !slices.Contains([]string{LogError, LogInfo, LogDebug}, c.LogLevel) {
+		return fmt.Errorf("unknown log level %q, expected %s, %s or %s", c.LogLevel, LogError, LogInfo, LogDebug)
+	}
+	if (c.Cert == "") != (c.Key == "") {
+		return errors.New("cert and key must be set together")
+	}
+	if c.IdleTimeout < 0 {
+		return fmt.Errorf("idle-timeout must not be negative, got %s", c.IdleTimeout)
+	}
+
+	if _, err := server.ParseNetworks(c.AllowNet); err != nil {
+		return fmt.Errorf("allow-net: %w", err)
+	}
+	if _, err := server.ParseControlPolicy(c.Control); err != nil {
+		return err
+	}
+	if _, err := mouse.ParseAccelProfile(c.Accel); err != nil {
+		return fmt.Errorf("accel: %w", err)
+	}
+
+	return c.MouseConfig().Validate()
+}
+
+// Address returns the address to listen on
+func (c *Config) Address() string {
+	return net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
+}
+
+// Network returns the network to listen on, "tcp4" when IPv6 is off
+func (c *Config) Network() string {
+	if c.IPv6 {
+		return "tcp"
+	}
+	return "tcp4"
+}
+
+// UsesTLS reports whether wss:// is served
+func (c *Config) UsesTLS() bool {
+	return c.TLS || c.Cert != ""
+}
+
+// Verbose reports whether connections and setting changes are logged
+func (c *Config) Verbose() bool {
+	return c.LogLevel != LogError
+}
+
+// StabilizationOptions returns the stabilization settings, nil when
+// stabilization is off
+func (c *Config) StabilizationOptions() *mouse.StabilizationOptions {
+	if !c.Stabilization {
+		return nil
+	}
+	return &mouse.StabilizationOptions{
+		DeadZone:       c.DeadZone,
+		SmoothingLevel: c.Smoothing,
+		JiggleFilter:   c.Jiggle,
+		AntiDrift:      c.Drift,
+	}
+}
+
+// MouseConfig returns the mouse controller configuration
+func (c *Config) MouseConfig() *mouse.Config {
+	config := mouse.DefaultConfig()
+	config.SpeedFactor = c.Speed
+	config.EnforceBounds = c.Bounds
+	config.Silent = c.LogLevel != LogDebug
+	config.Stabilization = c.StabilizationOptions()
+
+	// Validate reports a bad profile, linear applies no acceleration anyway
+	if profile, err := mouse.ParseAccelProfile(c.Accel); err == nil {
+		if _, linear := profile.(*mouse.LinearProfile); !linear {
+			config.Acceleration = profile
+		}
+	}
+	return config
+}
+
+// ServerConfig returns the server configuration, without the backend and
+// pairing, which are left to the caller
+func (c *Config) ServerConfig() (*server.WebSocketConfig, error) {
+	config := server.DefaultWebSocketConfig()
+	config.MouseConfig = c.MouseConfig()
+	config.KeyboardConfig.Silent = c.LogLevel != LogDebug
+	config.Verbose = c.Verbose()
+	config.IdleTimeout = time.Duration(c.IdleTimeout)
+
+	var err error
+	if config.Allowlist, err = c.Allowlist(); err != nil {
+		return nil, err
+	}
+	if config.ControlPolicy, err = server.ParseControlPolicy(c.Control); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// Allowlist returns the origins and networks connections may come from
+func (c *Config) Allowlist() (server.Allowlist, error) {
+	var allowlist server.Allowlist
+	allowlist.Origins = server.ParseOrigins(c.AllowOrigin)
+	if c.Host != "" && net.ParseIP(c.Host) == nil {
+		// Pages served under the configured name, addresses are recognized
+		// by the server
+		origin, defaultPort := "http://", 80
+		if c.UsesTLS() {
+			origin, defaultPort = "https://", 443
+		}
+		// Browsers leave the default port out
+		if c.Port == defaultPort {
+			origin += c.Host
+		} else {
+			origin += c.Address()
+		}
+		allowlist.Origins = append(allowlist.Origins, origin)
+	}
+
+	var err error
+	if allowlist.Networks, err = server.ParseNetworks(c.AllowNet); err != nil {
+		return allowlist, fmt.Errorf("allow-net: %w", err)
+	}
+	return allowlist, nil
+}
+
+// OpenBackend opens the named backend, nil selects mouse.DefaultBackend
+func (c *Config) OpenBackend() (mouse.Backend, error) {
+	if c.Backend == "" {
+		return nil, nil
+	}
+
+	backend, err := native.Open(c.Backend)
+	if err != nil {
+		return nil, fmt.Errorf("opening backend %s: %w", c.Backend, err)
+	}
+	return backend, nil
+}
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name  string
+		file  string
+		env   map[string]string
+		flags map[string]string
+		// want is the port, speed and idle timeout loaded
+		port    int
+		speed   float64
+		timeout time.Duration
+		err     bool
+	}{
+		{name: "defaults", port: 8080, speed: 1, timeout: 30 * time.Second},
+		{name: "file", file: `{"port":9000,"speed":2,"idle-timeout":"1m"}`, port: 9000, speed: 2, timeout: time.Minute},
+		{
+			name: "environment over file",
+			file: `{"port":9000,"speed":2}`, env: map[string]string{"REMOTE_MOUSE_PORT": "9100", "REMOTE_MOUSE_IDLE_TIMEOUT": "5s"},
+			port: 9100, speed: 2, timeout: 5 * time.Second,
+		},
+		{
+			name: "flags over environment",
+			file: `{"port":9000,"speed":2}`, env: map[string]string{"REMOTE_MOUSE_PORT": "9100", "REMOTE_MOUSE_SPEED": "3"},
+			flags: map[string]string{"port": "9200"},
+			port:  9200, speed: 3, timeout: 30 * time.Second,
+		},
+		{name: "flags over defaults", flags: map[string]string{"speed": "0.5", "idle-timeout": "0s"}, port: 8080, speed: 0.5},
+		{name: "unknown key in file", file: `{"prot":9000}`, err: true},
+		{name: "malformed file", file: `{"port":`, err: true},
+		{name: "invalid environment value", env: map[string]string{"REMOTE_MOUSE_PORT": "eighty"}, err: true},
+		{name: "invalid flag", flags: map[string]string{"bounds": "maybe"}, err: true},
+		{name: "out of range", flags: map[string]string{"port": "70000"}, err: true},
+		{name: "file out of range overridden", file: `{"speed":-1}`, flags: map[string]string{"speed": "2"}, port: 8080, speed: 2, timeout: 30 * time.Second},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Keep the real config file and environment out of the way
+			dir := t.TempDir()
+			t.Setenv("XDG_CONFIG_HOME", dir)
+			t.Setenv("HOME", dir)
+			t.Setenv("AppData", dir)
+			for _, key := range Keys() {
+				t.Setenv(EnvName(key), "")
+				os.Unsetenv(EnvName(key))
+			}
+			for name, value := range test.env {
+				t.Setenv(name, value)
+			}
+
+			path := ""
+			if test.file != "" {
+				path = filepath.Join(dir, "config.json")
+				if err := os.WriteFile(path, []byte(test.file), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			config, err := Load(path, test.flags)
+			if (err != nil) != test.err {
+				t.Fatalf("error %v, want error %v", err, test.err)
+			}
+			if err != nil {
+				return
+			}
+			if config.Port != test.port || config.Speed != test.speed || time.Duration(config.IdleTimeout) != test.timeout {
+				t.Errorf("port %d, speed %g, idle-timeout %s, want %d, %g, %s",
+					config.Port, config.Speed, config.IdleTimeout, test.port, test.speed, test.timeout)
+			}
+		})
+	}
+}
+
+func TestLoadDefaultPath(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("HOME", dir)
+	t.Setenv("AppData", dir)
+	t.Setenv("REMOTE_MOUSE_PORT", "")
+	os.Unsetenv("REMOTE_MOUSE_PORT")
+
+	path, err := DefaultPath()
+	if err != nil {
+		t.Skip(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(`{"port":9300}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := Load("", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Port != 9300 {
+		t.Errorf("port %d, want 9300 from %s", config.Port, path)
+	}
+}
@@ -0,0 +1,177 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/tommyalmeida/remote-mouse/mouse"
+	"github.com/tommyalmeida/remote-mouse/server"
+)
+
+// reloadable are the settings Server.Reconfigure applies while running,
+// the others only apply after a restart
+var reloadable = map[string]bool{
+	"idle-timeout":  true,
+	"allow-net":     true,
+	"allow-origin":  true,
+	"speed":         true,
+	"bounds":        true,
+	"accel":         true,
+	"stabilization": true,
+	"deadzone":      true,
+	"smoothing":     true,
+	"jiggle":        true,
+	"drift":         true,
+}
+
+// Reloadable reports whether a change of the setting applies without a restart
+func Reloadable(key string) bool {
+	return reloadable[key]
+}
+
+// Change is a setting with a different value in a new configuration
+type Change struct {
+	Key string
+	// Old and New are the values as written in the file
+	Old string
+	New string
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %s -> %s", c.Key, c.Old, c.New)
+}
+
+// Changes returns the settings that differ in next, in the order of Keys
+func (c *Config) Changes(next *Config) []Change {
+	old, current := c.values(), next.values()
+
+	var changes []Change
+	for _, key := range keys {
+		if old[key] != current[key] {
+			changes = append(changes, Change{Key: key, Old: old[key], New: current[key]})
+		}
+	}
+	return changes
+}
+
+// Reload returns a copy of c with the reloadable settings of next, the
+// configuration in effect once next is applied without a restart
+func (c *Config) Reload(next *Config) *Config {
+	reloaded := *c
+	for _, change := range c.Changes(next) {
+		if reloadable[change.Key] {
+			// New is valid JSON for the field, it was marshalled from one
+			json.Unmarshal(fmt.Appendf(nil, "{%q:%s}", change.Key, change.New), &reloaded)
+		}
+	}
+	return &reloaded
+}
+
+// Reconfiguration returns the settings of c for Server.Reconfigure, only
+// the reloadable ones among changes are set
+func (c *Config) Reconfiguration(changes []Change) (server.Reconfiguration, error) {
+	var reconfiguration server.Reconfiguration
+
+	for _, change := range changes {
+		switch change.Key {
+		case "speed":
+			reconfiguration.SpeedFactor = &c.Speed
+		case "bounds":
+			reconfiguration.EnforceBounds = &c.Bounds
+		case "accel":
+			profile, err := mouse.ParseAccelProfile(c.Accel)
+			if err != nil {
+				return reconfiguration, fmt.Errorf("accel: %w", err)
+			}
+			reconfiguration.Acceleration = profile
+		case "stabilization":
+			reconfiguration.Stabilization.Enabled = &c.Stabilization
+		case "deadzone":
+			reconfiguration.Stabilization.DeadZone = &c.DeadZone
+		case "smoothing":
+			reconfiguration.Stabilization.SmoothingLevel = &c.Smoothing
+		case "jiggle":
+			reconfiguration.Stabilization.JiggleFilter = &c.Jiggle
+		case "drift":
+			reconfiguration.Stabilization.AntiDrift = &c.Drift
+		case "idle-timeout":
+			timeout := time.Duration(c.IdleTimeout)
+			reconfiguration.IdleTimeout = &timeout
+		case "allow-net", "allow-origin":
+			allowlist, err := c.Allowlist()
+			if err != nil {
+				return reconfiguration, err
+			}
+			reconfiguration.Allowlist = &allowlist
+		}
+	}
+	return reconfiguration, nil
+}
+
+// values returns every setting by key, formatted as in the file
+func (c *Config) values() map[string]string {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil
+	}
+
+	values := make(map[string]string, len(fields))
+	for key, value := range fields {
+		values[key] = string(value)
+	}
+	return values
+}
+
+// fileState is what Watch compares to notice a change
+type fileState struct {
+	exists  bool
+	size    int64
+	modTime int64
+}
+
+func statFile(path string) fileState {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileState{}
+	}
+	return fileState{exists: true, size: info.Size(), modTime: info.ModTime().UnixNano()}
+}
+
+// Watch checks the file at path every interval until ctx is done, and
+// sends on the returned channel when it was created, changed or removed.
+// Changes noticed while the last one wasn't received yet are merged.
+func Watch(ctx context.Context, path string, interval time.Duration) <-chan struct{} {
+	changed := make(chan struct{}, 1)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		last := statFile(path)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			if current := statFile(path); current != last {
+				last = current
+				select {
+				case changed <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+
+	return changed
+}
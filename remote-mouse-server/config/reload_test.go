@@ -0,0 +1,50 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReload(t *testing.T) {
+	current := Default()
+	next := Default()
+	next.Port = current.Port + 1
+	next.TLS = true
+	next.Speed = 2
+	next.Smoothing = 0.5
+	next.IdleTimeout = Duration(time.Minute)
+
+	changes := current.Changes(next)
+	reloaded := current.Reload(next)
+
+	// Restart-only settings keep the value in effect
+	if reloaded.Port != current.Port || reloaded.TLS != current.TLS {
+		t.Errorf("port %d, tls %v, want the current %d, %v", reloaded.Port, reloaded.TLS, current.Port, current.TLS)
+	}
+	if reloaded.Speed != 2 || reloaded.Smoothing != 0.5 || reloaded.IdleTimeout != next.IdleTimeout {
+		t.Errorf("speed %g, smoothing %g, idle-timeout %s, want the new values", reloaded.Speed, reloaded.Smoothing, reloaded.IdleTimeout)
+	}
+
+	reconfiguration, err := reloaded.Reconfiguration(changes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reconfiguration.SpeedFactor == nil || *reconfiguration.SpeedFactor != 2 {
+		t.Errorf("speed %v, want 2", reconfiguration.SpeedFactor)
+	}
+	if reconfiguration.Stabilization.SmoothingLevel == nil || *reconfiguration.Stabilization.SmoothingLevel != 0.5 {
+		t.Errorf("smoothing %v, want 0.5", reconfiguration.Stabilization.SmoothingLevel)
+	}
+	if reconfiguration.IdleTimeout == nil || *reconfiguration.IdleTimeout != time.Minute {
+		t.Errorf("idle timeout %v, want 1m", reconfiguration.IdleTimeout)
+	}
+
+	// Unchanged settings are left to what clients set
+	if reconfiguration.EnforceBounds != nil || reconfiguration.Acceleration != nil || reconfiguration.Allowlist != nil {
+		t.Error("unchanged settings are reconfigured")
+	}
+	stabilization := reconfiguration.Stabilization
+	if stabilization.Enabled != nil || stabilization.DeadZone != nil || stabilization.JiggleFilter != nil || stabilization.AntiDrift != nil {
+		t.Error("unchanged stabilization settings are reconfigured")
+	}
+}
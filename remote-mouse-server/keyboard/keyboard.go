@@ -0,0 +1,189 @@
+package keyboard
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tommyalmeida/remote-mouse/mouse"
+	"github.com/tommyalmeida/remote-mouse/mouse/native"
+)
+
+// Backend is the interface the controller uses to inject key events.
+// Every mouse backend implements it.
+type Backend = native.Keyboard
+
+// Key identifies a key in a layout-independent way
+type Key = native.Key
+
+// ParseKey returns the key with the given name, e.g. "a", "f5", "enter" or "ctrl"
+func ParseKey(name string) (Key, error) {
+	return native.ParseKey(name)
+}
+
+// ParseCombo parses a combination of keys joined by '+', e.g. "ctrl+shift+t".
+// Keys are returned in the order they must be pressed.
+func ParseCombo(combo string) ([]Key, error) {
+	if strings.TrimSpace(combo) == "" {
+		return nil, errors.New("empty key combination")
+	}
+
+	names := strings.Split(combo, "+")
+	keys := make([]Key, 0, len(names))
+	for _, name := range names {
+		key, err := ParseKey(name)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// Config holds the keyboard controller configuration
+type Config struct {
+	// Silent disables logging to stdout
+	Silent bool
+	// TypingDelay is the pause between characters when typing text.
+	// Some applications drop characters that arrive too quickly.
+	TypingDelay time.Duration
+}
+
+// DefaultConfig returns a default configuration
+func DefaultConfig() *Config {
+	return &Config{
+		Silent:      false,
+		TypingDelay: 5 * time.Millisecond,
+	}
+}
+
+// Controller injects key presses and text
+type Controller struct {
+	config  *Config
+	backend Backend
+
+	// mu keeps the events of one combo or string from interleaving with another
+	mu sync.Mutex
+}
+
+// NewController creates a new keyboard controller with the given configuration,
+// injecting events through backend. A nil backend selects mouse.DefaultBackend,
+// so the keyboard and the mouse share the same device.
+func NewController(config *Config, backend Backend) *Controller {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	if backend == nil {
+		backend = mouse.DefaultBackend()
+	}
+
+	return &Controller{
+		config:  config,
+		backend: backend,
+	}
+}
+
+// KeyDown presses and holds a key
+func (c *Controller) KeyDown(key Key) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.backend.KeyDown(key); err != nil {
+		return err
+	}
+	if !c.config.Silent {
+		fmt.Printf("Key %s down\n", key)
+	}
+	return nil
+}
+
+// KeyUp releases a key
+func (c *Controller) KeyUp(key Key) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.backend.KeyUp(key); err != nil {
+		return err
+	}
+	if !c.config.Silent {
+		fmt.Printf("Key %s up\n", key)
+	}
+	return nil
+}
+
+// Tap presses the keys in order and releases them in reverse order,
+// so Tap(KeyCtrl, KeyShift, KeyT) sends ctrl+shift+t
+func (c *Controller) Tap(keys ...Key) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.tap(keys...); err != nil {
+		return err
+	}
+	if !c.config.Silent {
+		names := make([]string, len(keys))
+		for i, key := range keys {
+			names[i] = key.String()
+		}
+		fmt.Printf("Key tap %s\n", strings.Join(names, "+"))
+	}
+	return nil
+}
+
+// tap does the work of Tap. Must be called with c.mu held.
+func (c *Controller) tap(keys ...Key) error {
+	for i, key := range keys {
+		if err := c.backend.KeyDown(key); err != nil {
+			// Don't leave modifiers stuck down
+			return errors.Join(err, c.release(keys[:i]))
+		}
+	}
+	return c.release(keys)
+}
+
+// release lets go of the keys in reverse order. Must be called with c.mu held.
+func (c *Controller) release(keys []Key) error {
+	var errs []error
+	for i := len(keys) - 1; i >= 0; i-- {
+		if err := c.backend.KeyUp(keys[i]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Type types the text, which may contain any Unicode characters.
+// Newlines and tabs press Enter and Tab.
+func (c *Controller) Type(text string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, r := range text {
+		if i > 0 && c.config.TypingDelay > 0 {
+			time.Sleep(c.config.TypingDelay)
+		}
+
+		var err error
+		switch r {
+		case '\r':
+			// "\r\n" would otherwise press Enter twice
+			continue
+		case '\n':
+			err = c.tap(native.KeyEnter)
+		case '\t':
+			err = c.tap(native.KeyTab)
+		default:
+			err = c.backend.TypeRune(r)
+		}
+		if err != nil {
+			return fmt.Errorf("typing %q: %w", r, err)
+		}
+	}
+
+	if !c.config.Silent {
+		fmt.Printf("Typed %d characters\n", len([]rune(text)))
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package keyboard
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/tommyalmeida/remote-mouse/mouse/native"
+)
+
+func TestParseCombo(t *testing.T) {
+	tests := []struct {
+		combo string
+		want  []Key
+		err   bool
+	}{
+		{combo: "a", want: []Key{native.KeyA}},
+		{combo: "ctrl+shift+t", want: []Key{native.KeyCtrl, native.KeyShift, native.KeyT}},
+		{combo: " Cmd + Q ", want: []Key{native.KeyMeta, native.KeyQ}},
+		{combo: "alt+f4", want: []Key{native.KeyAlt, native.KeyF4}},
+		{combo: "", err: true},
+		{combo: "   ", err: true},
+		{combo: "ctrl+", err: true},
+		{combo: "+a", err: true},
+		{combo: "ctrl++", err: true},
+		{combo: "ctrl+bogus", err: true},
+		{combo: "ctrl;c", err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.combo, func(t *testing.T) {
+			keys, err := ParseCombo(test.combo)
+			if (err != nil) != test.err {
+				t.Fatalf("error %v, want error %v", err, test.err)
+			}
+			if !slices.Equal(keys, test.want) {
+				t.Errorf("keys %v, want %v", keys, test.want)
+			}
+		})
+	}
+}
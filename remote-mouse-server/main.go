@@ -1,26 +1,276 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
 	"fmt"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/tommyalmeida/remote-mouse/config"
+	"github.com/tommyalmeida/remote-mouse/mouse/native"
 	"github.com/tommyalmeida/remote-mouse/server"
 )
 
+// defineFlags adds a flag for every setting, with its default as the default
+func defineFlags(defaults *config.Config) {
+	flag.StringVar(&defaults.Host, "host", defaults.Host, "address to listen on, e.g. 192.168.1.10 or ::1 (every interface when empty)")
+	flag.IntVar(&defaults.Port, "port", defaults.Port, "port to listen on")
+	flag.BoolVar(&defaults.IPv6, "ipv6", defaults.IPv6, "also accept IPv6 connections, only IPv4 ones when false")
+	flag.StringVar(&defaults.Static, "static", defaults.Static, "directory with the web app served next to /ws")
+	flag.StringVar(&defaults.Backend, "backend", defaults.Backend, fmt.Sprintf("input backend, one of %s (the platform's best when empty)", strings.Join(native.Available(), ", ")))
+	flag.StringVar(&defaults.LogLevel, "log-level", defaults.LogLevel, "error, info (connections and settings) or debug (every event)")
+
+	flag.StringVar(&defaults.UDP, "udp", defaults.UDP, "address for movement datagrams, e.g. :8081 (disabled when empty)")
+	flag.BoolVar(&defaults.NoPairing, "no-pairing", defaults.NoPairing, "accept every connection without pairing, only safe on trusted networks")
+	flag.BoolVar(&defaults.TLS, "tls", defaults.TLS, "serve wss:// with a self-signed certificate generated on first run")
+	flag.StringVar(&defaults.Cert, "cert", defaults.Cert, "certificate file for wss://, e.g. one signed by your own CA (implies -tls)")
+	flag.StringVar(&defaults.Key, "key", defaults.Key, "private key file of -cert")
+	flag.StringVar(&defaults.AllowNet, "allow-net", defaults.AllowNet, "comma separated networks allowed to connect, e.g. 192.168.1.0/24 or loopback,tailscale (all when empty)")
+	flag.StringVar(&defaults.AllowOrigin, "allow-origin", defaults.AllowOrigin, "comma separated origins of web pages allowed to connect besides this server's, * for all")
+	flag.StringVar(&defaults.Control, "control", defaults.Control, "who gets control when several devices want it: first-wins, last-wins or ask")
+	flag.Var(&defaults.IdleTimeout, "idle-timeout", "release the buttons and keys of a client silent this long, 0 only on disconnect")
+
+	flag.Float64Var(&defaults.Speed, "speed", defaults.Speed, "movement speed multiplier")
+	flag.BoolVar(&defaults.Bounds, "bounds", defaults.Bounds, "keep the pointer on the screen")
+	flag.StringVar(&defaults.Accel, "accel", defaults.Accel, "acceleration profile, e.g. linear, adaptive or power,exponent=2")
+	flag.BoolVar(&defaults.Stabilization, "stabilization", defaults.Stabilization, "filter drift and jiggle out of the movement")
+	flag.IntVar(&defaults.DeadZone, "deadzone", defaults.DeadZone, "stabilization: ignore movements smaller than this many pixels")
+	flag.Float64Var(&defaults.Smoothing, "smoothing", defaults.Smoothing, "stabilization: smoothing between 0 and 1")
+	flag.BoolVar(&defaults.Jiggle, "jiggle", defaults.Jiggle, "stabilization: filter jiggle")
+	flag.BoolVar(&defaults.Drift, "drift", defaults.Drift, "stabilization: compensate drift")
+}
+
+// setFlags returns the settings given on the command line, by key
+func setFlags() map[string]string {
+	settings := make(map[string]string)
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name != "config" {
+			settings[f.Name] = f.Value.String()
+		}
+	})
+	return settings
+}
+
+// reloader applies the configuration again while the server runs
+type reloader struct {
+	srv   *server.Server
+	path  string
+	flags map[string]string
+
+	// current is the configuration in effect, loaded is the one last read.
+	// They differ in the settings that only apply after a restart.
+	current *config.Config
+	loaded  *config.Config
+}
+
+// reload loads the configuration again and applies the settings that
+// changed since it was last read to the server. Settings that only apply
+// after a restart keep their current value. An invalid configuration is
+// logged and the current one kept.
+func (r *reloader) reload() {
+	next, err := config.Load(r.path, r.flags)
+	if err != nil {
+		fmt.Println("Keeping the current configuration:", err)
+		return
+	}
+
+	changes := r.loaded.Changes(next)
+	if len(changes) == 0 {
+		return
+	}
+
+	reloaded := r.current.Reload(next)
+	reconfiguration, err := reloaded.Reconfiguration(changes)
+	if err != nil {
+		fmt.Println("Keeping the current configuration:", err)
+		return
+	}
+	if err := r.srv.Reconfigure(reconfiguration); err != nil {
+		fmt.Println("Keeping the current configuration:", err)
+		return
+	}
+
+	// Restart-only settings may be changed back to the value in effect
+	pending := make(map[string]bool)
+	for _, change := range reloaded.Changes(next) {
+		pending[change.Key] = true
+	}
+	for _, change := range changes {
+		switch {
+		case config.Reloadable(change.Key):
+			fmt.Println("Configuration changed,", change)
+		case pending[change.Key]:
+			fmt.Printf("Configuration changed, %s (applies after a restart)\n", change)
+		default:
+			fmt.Printf("Configuration changed, %s (back to the value in effect)\n", change)
+		}
+	}
+	r.current, r.loaded = reloaded, next
+}
+
+// certificate loads the certificate of -cert, or the self-signed one,
+// generating it on first run
+func certificate(settings *config.Config) (tls.Certificate, error) {
+	if settings.Cert != "" {
+		return tls.LoadX509KeyPair(settings.Cert, settings.Key)
+	}
+
+	certPath, keyPath, err := server.DefaultCertificatePaths()
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("locating the certificate: %w", err)
+	}
+
+	cert, created, err := server.LoadOrCreateCertificate(certPath, keyPath)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	if created {
+		fmt.Println("Generated a self-signed certificate in", certPath)
+	}
+	return cert, nil
+}
+
 func main() {
-	if count := server.GetActiveConnectionCount(); count > 0 {
-		fmt.Printf("WARNING: %d active connections detected on startup. This may cause unexpected mouse movement.\n", count)
+	configPath := flag.String("config", os.Getenv(config.EnvPrefix+"CONFIG"), "JSON config file, settings in it are overridden by REMOTE_MOUSE_* variables and flags")
+	defineFlags(config.Default())
+	flag.Parse()
+
+	// Flags override the environment, which overrides the file
+	flags := setFlags()
+	settings, err := config.Load(*configPath, flags)
+	if err != nil {
+		fmt.Println("Error in the configuration:", err)
+		os.Exit(2)
 	}
 
-	fs := http.FileServer(http.Dir("."))
+	fs := http.FileServer(http.Dir(settings.Static))
 	http.Handle("/", fs)
-	
-	http.HandleFunc("/ws", server.WSHandler)
-	
-	fmt.Println("Remote Mouse Server started on localhost:8080")
-	fmt.Println("Connect at http://localhost:8080 to control the mouse")
-	err := http.ListenAndServe("0.0.0.0:8080", nil)
+
+	var tlsConfig *tls.Config
+	if settings.UsesTLS() {
+		cert, err := certificate(settings)
+		if err != nil {
+			fmt.Println("Error loading certificate:", err)
+			return
+		}
+		tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+
+		// Clients compare it with the certificate they see when pairing, and pin it
+		fmt.Println("Certificate fingerprint (SHA-256):", server.CertificateFingerprint(cert))
+	}
+
+	serverConfig, err := settings.ServerConfig()
 	if err != nil {
+		fmt.Println("Error in the configuration:", err)
+		return
+	}
+	if serverConfig.Backend, err = settings.OpenBackend(); err != nil {
+		fmt.Println("Error in the configuration:", err)
+		return
+	}
+
+	if !settings.NoPairing {
+		path, err := server.DefaultPairingPath()
+		if err != nil {
+			fmt.Println("Error locating the devices file:", err)
+			return
+		}
+
+		if serverConfig.Pairing, err = server.NewPairing(path, serverConfig.Verbose); err != nil {
+			fmt.Println("Error loading paired devices:", err)
+			return
+		}
+		fmt.Printf("Enter the PIN in the app to pair a new device (%d paired so far)\n", len(serverConfig.Pairing.Devices()))
+	}
+
+	// One server for every connection, settings a client changes are kept
+	srv := server.NewServer(serverConfig)
+	defer srv.Close()
+	http.Handle("/ws", srv)
+
+	if settings.UDP != "" {
+		listener, err := srv.ListenUDP(settings.UDP)
+		if err != nil {
+			fmt.Println("Error starting UDP listener:", err)
+			return
+		}
+
+		go func() {
+			if err := listener.Serve(); err != nil {
+				fmt.Println("UDP listener stopped:", err)
+			}
+		}()
+		fmt.Printf("Accepting movement datagrams on UDP port %d\n", listener.Port())
+	}
+
+	// Apply the file again when it changes or on SIGHUP, keeping every
+	// connection open
+	watchPath := *configPath
+	if watchPath == "" {
+		watchPath, _ = config.DefaultPath()
+	}
+	var changed <-chan struct{}
+	if watchPath != "" {
+		changed = config.Watch(context.Background(), watchPath, 2*time.Second)
+	}
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	reloader := &reloader{srv: srv, path: *configPath, flags: flags, current: settings, loaded: settings}
+	go func() {
+		for {
+			select {
+			case <-changed:
+			case <-hangups:
+			}
+			reloader.reload()
+		}
+	}()
+
+	listener, err := net.Listen(settings.Network(), settings.Address())
+	if err != nil {
+		fmt.Println("Error starting server:", err)
+		return
+	}
+	httpServer := &http.Server{TLSConfig: tlsConfig}
+
+	// On Ctrl+C disconnect every client first, releasing any button or key
+	// still held, then stop the server
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		fmt.Println("Shutting down")
+		srv.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		httpServer.Shutdown(ctx)
+	}()
+
+	host := settings.Host
+	if host == "" {
+		host = "localhost"
+	}
+	address := net.JoinHostPort(host, fmt.Sprint(settings.Port))
+
+	if tlsConfig != nil {
+		fmt.Printf("Remote Mouse Server started on %s (wss://)\n", address)
+		fmt.Printf("Connect at https://%s to control the mouse\n", address)
+		err = httpServer.ServeTLS(listener, "", "")
+	} else {
+		fmt.Printf("Remote Mouse Server started on %s\n", address)
+		fmt.Printf("Connect at http://%s to control the mouse\n", address)
+		err = httpServer.Serve(listener)
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		fmt.Println("Error starting server:", err)
 	}
-}
\ No newline at end of file
+}
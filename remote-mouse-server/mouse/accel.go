@@ -0,0 +1,257 @@
+package mouse
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AccelProfile maps the pointer velocity to a gain multiplying the movement,
+// so slow motion can stay precise while fast motion covers the screen.
+// Velocities are in input units per second, before SpeedFactor is applied.
+type AccelProfile interface {
+	// Name returns the name the profile is selected with
+	Name() string
+	// Gain returns the multiplier for a movement at the given velocity
+	Gain(velocity float64) float64
+	// Set changes a tunable parameter
+	Set(param string, value float64) error
+	// Params returns the current value of every tunable parameter
+	Params() map[string]float64
+}
+
+// LinearProfile applies no acceleration, movement is only scaled by SpeedFactor
+type LinearProfile struct{}
+
+func (p *LinearProfile) Name() string                  { return "linear" }
+func (p *LinearProfile) Gain(velocity float64) float64 { return 1 }
+func (p *LinearProfile) Params() map[string]float64    { return map[string]float64{} }
+
+func (p *LinearProfile) Set(param string, value float64) error {
+	return fmt.Errorf("unknown linear acceleration parameter: %s", param)
+}
+
+// PowerProfile raises the velocity to a power above a threshold:
+// gain = (velocity/Threshold)^(Exponent-1), capped at MaxGain
+type PowerProfile struct {
+	// Exponent shapes the curve, 1 is linear and higher values accelerate harder
+	Exponent float64
+	// Threshold is the velocity where acceleration starts
+	Threshold float64
+	// MaxGain caps the multiplier
+	MaxGain float64
+}
+
+// NewPowerProfile creates a power curve with default parameters
+func NewPowerProfile() *PowerProfile {
+	return &PowerProfile{
+		Exponent:  1.5,
+		Threshold: 200,
+		MaxGain:   4,
+	}
+}
+
+func (p *PowerProfile) Name() string { return "power" }
+
+func (p *PowerProfile) Gain(velocity float64) float64 {
+	if velocity <= p.Threshold {
+		return 1
+	}
+	return math.Min(math.Pow(velocity/p.Threshold, p.Exponent-1), p.MaxGain)
+}
+
+func (p *PowerProfile) Set(param string, value float64) error {
+	switch param {
+	case "exponent":
+		if value < 1 {
+			return fmt.Errorf("exponent must be at least 1, got %g", value)
+		}
+		p.Exponent = value
+	case "threshold":
+		if value <= 0 {
+			return fmt.Errorf("threshold must be positive, got %g", value)
+		}
+		p.Threshold = value
+	case "maxgain":
+		if value < 1 {
+			return fmt.Errorf("maxgain must be at least 1, got %g", value)
+		}
+		p.MaxGain = value
+	default:
+		return fmt.Errorf("unknown power acceleration parameter: %s", param)
+	}
+	return nil
+}
+
+func (p *PowerProfile) Params() map[string]float64 {
+	return map[string]float64{
+		"exponent":  p.Exponent,
+		"threshold": p.Threshold,
+		"maxgain":   p.MaxGain,
+	}
+}
+
+// AdaptiveProfile follows libinput's adaptive profile: slow movements are
+// slowed down further for precision, the gain is 1 around Threshold and
+// then grows linearly with velocity until MaxGain
+type AdaptiveProfile struct {
+	// Threshold is the velocity where the gain reaches 1
+	Threshold float64
+	// Accel is the gain added per unit of velocity above Threshold
+	Accel float64
+	// MaxGain caps the multiplier
+	MaxGain float64
+	// Decel is the gain at rest, rising linearly to 1 at Threshold
+	Decel float64
+}
+
+// NewAdaptiveProfile creates an adaptive curve with default parameters
+func NewAdaptiveProfile() *AdaptiveProfile {
+	return &AdaptiveProfile{
+		Threshold: 300,
+		Accel:     0.004,
+		MaxGain:   3.5,
+		Decel:     0.7,
+	}
+}
+
+func (p *AdaptiveProfile) Name() string { return "adaptive" }
+
+func (p *AdaptiveProfile) Gain(velocity float64) float64 {
+	if velocity < p.Threshold {
+		return p.Decel + (1-p.Decel)*velocity/p.Threshold
+	}
+	return math.Min(1+(velocity-p.Threshold)*p.Accel, p.MaxGain)
+}
+
+func (p *AdaptiveProfile) Set(param string, value float64) error {
+	switch param {
+	case "threshold":
+		if value <= 0 {
+			return fmt.Errorf("threshold must be positive, got %g", value)
+		}
+		p.Threshold = value
+	case "accel":
+		if value < 0 {
+			return fmt.Errorf("accel must not be negative, got %g", value)
+		}
+		p.Accel = value
+	case "maxgain":
+		if value < 1 {
+			return fmt.Errorf("maxgain must be at least 1, got %g", value)
+		}
+		p.MaxGain = value
+	case "decel":
+		if value <= 0 || value > 1 {
+			return fmt.Errorf("decel must be between 0 and 1, got %g", value)
+		}
+		p.Decel = value
+	default:
+		return fmt.Errorf("unknown adaptive acceleration parameter: %s", param)
+	}
+	return nil
+}
+
+func (p *AdaptiveProfile) Params() map[string]float64 {
+	return map[string]float64{
+		"threshold": p.Threshold,
+		"accel":     p.Accel,
+		"maxgain":   p.MaxGain,
+		"decel":     p.Decel,
+	}
+}
+
+// NewAccelProfile creates the named profile with default parameters
+func NewAccelProfile(name string) (AccelProfile, error) {
+	switch name {
+	case "linear", "none", "flat":
+		return &LinearProfile{}, nil
+	case "power":
+		return NewPowerProfile(), nil
+	case "adaptive":
+		return NewAdaptiveProfile(), nil
+	}
+	return nil, fmt.Errorf("unknown acceleration profile: %s", name)
+}
+
+// ParseAccelProfile parses a profile name followed by optional parameters,
+// e.g. "power,exponent=2,threshold=150"
+func ParseAccelProfile(spec string) (AccelProfile, error) {
+	parts := strings.Split(spec, ",")
+
+	profile, err := NewAccelProfile(strings.ToLower(strings.TrimSpace(parts[0])))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, part := range parts[1:] {
+		param, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid acceleration parameter %q, expected 'name=value'", part)
+		}
+		number, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || math.IsNaN(number) || math.IsInf(number, 0) {
+			return nil, fmt.Errorf("invalid value for acceleration parameter %s: %q", param, value)
+		}
+		if err := profile.Set(strings.ToLower(strings.TrimSpace(param)), number); err != nil {
+			return nil, err
+		}
+	}
+
+	return profile, nil
+}
+
+// FormatAccelProfile returns the spec ParseAccelProfile would parse back into profile
+func FormatAccelProfile(profile AccelProfile) string {
+	params := profile.Params()
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	spec := profile.Name()
+	for _, name := range names {
+		spec += fmt.Sprintf(",%s=%g", name, params[name])
+	}
+	return spec
+}
+
+const (
+	// velocityTimeout is how long the pointer can rest before the next
+	// movement is treated as the start of a new gesture
+	velocityTimeout = 100 * time.Millisecond
+	// minVelocityInterval avoids huge velocities from events delivered in a burst
+	minVelocityInterval = 4 * time.Millisecond
+	// velocitySmoothing is the weight of the previous velocity estimate
+	velocitySmoothing = 0.5
+)
+
+// velocityTracker estimates the pointer velocity from the movement deltas
+type velocityTracker struct {
+	last     time.Time
+	velocity float64
+}
+
+// update records a movement and returns the smoothed velocity in units per second
+func (t *velocityTracker) update(deltaX, deltaY float64, now time.Time) float64 {
+	elapsed := now.Sub(t.last)
+	t.last = now
+
+	distance := math.Hypot(deltaX, deltaY)
+	if elapsed > velocityTimeout {
+		// First movement of a gesture, there's nothing to measure against
+		t.velocity = distance / velocityTimeout.Seconds()
+		return t.velocity
+	}
+	if elapsed < minVelocityInterval {
+		elapsed = minVelocityInterval
+	}
+
+	velocity := distance / elapsed.Seconds()
+	t.velocity = t.velocity*velocitySmoothing + velocity*(1-velocitySmoothing)
+	return t.velocity
+}
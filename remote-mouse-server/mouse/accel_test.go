@@ -0,0 +1,89 @@
+package mouse
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseAccelProfile(t *testing.T) {
+	tests := []struct {
+		spec string
+		want string
+		err  bool
+	}{
+		{spec: "linear", want: "linear"},
+		{spec: " None ", want: "linear"},
+		{spec: "power", want: "power,exponent=1.5,maxgain=4,threshold=200"},
+		{spec: "power,exponent=2, threshold = 150", want: "power,exponent=2,maxgain=4,threshold=150"},
+		{spec: "adaptive,MaxGain=2", want: "adaptive,accel=0.004,decel=0.7,maxgain=2,threshold=300"},
+		{spec: "", err: true},
+		{spec: "turbo", err: true},
+		{spec: "power,exponent", err: true},
+		{spec: "power,exponent=fast", err: true},
+		{spec: "power,exponent=NaN", err: true},
+		{spec: "power,exponent=Inf", err: true},
+		{spec: "power,exponent=0.5", err: true},
+		{spec: "power,threshold=0", err: true},
+		{spec: "adaptive,decel=0", err: true},
+		{spec: "adaptive,decel=1.5", err: true},
+		{spec: "adaptive,exponent=2", err: true},
+		{spec: "linear,gain=2", err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.spec, func(t *testing.T) {
+			profile, err := ParseAccelProfile(test.spec)
+			if (err != nil) != test.err {
+				t.Fatalf("error %v, want error %v", err, test.err)
+			}
+			if err != nil {
+				return
+			}
+			spec := FormatAccelProfile(profile)
+			if spec != test.want {
+				t.Errorf("parsed as %s, want %s", spec, test.want)
+			}
+			if again, err := ParseAccelProfile(spec); err != nil || FormatAccelProfile(again) != spec {
+				t.Errorf("%s doesn't parse back: %v", spec, err)
+			}
+		})
+	}
+}
+
+func TestGainCurve(t *testing.T) {
+	adaptive := NewAdaptiveProfile()
+	tests := []struct {
+		profile AccelProfile
+		// rest is the gain at zero velocity
+		rest float64
+		max  float64
+	}{
+		{profile: &LinearProfile{}, rest: 1, max: 1},
+		{profile: NewPowerProfile(), rest: 1, max: 4},
+		// Adaptive slows slow movements down for precision
+		{profile: adaptive, rest: adaptive.Decel, max: adaptive.MaxGain},
+	}
+
+	for _, test := range tests {
+		t.Run(test.profile.Name(), func(t *testing.T) {
+			if gain := test.profile.Gain(0); gain != test.rest {
+				t.Errorf("gain %g at rest, want %g", gain, test.rest)
+			}
+
+			last := test.profile.Gain(0)
+			for velocity := 10.0; velocity <= 20000; velocity += 10 {
+				gain := test.profile.Gain(velocity)
+				if gain < last {
+					t.Fatalf("gain drops from %g to %g at %g", last, gain, velocity)
+				}
+				if gain > test.max || math.IsNaN(gain) {
+					t.Fatalf("gain %g at %g, want at most %g", gain, velocity, test.max)
+				}
+				last = gain
+			}
+			if last != test.max {
+				t.Errorf("gain %g at high velocity, want the cap %g", last, test.max)
+			}
+		})
+	}
+}
@@ -1,8 +1,12 @@
 package mouse
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/tommyalmeida/remote-mouse/mouse/native"
 )
@@ -12,11 +16,39 @@ type ClickType string
 
 // Valid mouse click types
 const (
-	LeftClick   ClickType = "left"
-	RightClick  ClickType = "right"
-	DoubleClick ClickType = "double"
+	LeftClick    ClickType = "left"
+	RightClick   ClickType = "right"
+	MiddleClick  ClickType = "middle"
+	BackClick    ClickType = "back"
+	ForwardClick ClickType = "forward"
+	DoubleClick  ClickType = "double"
 )
 
+// Backend is the interface the controller uses to inject events.
+// Implementations live in the native package.
+type Backend = native.Backend
+
+// Button identifies a mouse button
+type Button = native.Button
+
+// Mouse buttons
+const (
+	ButtonLeft    = native.ButtonLeft
+	ButtonRight   = native.ButtonRight
+	ButtonMiddle  = native.ButtonMiddle
+	ButtonBack    = native.ButtonBack
+	ButtonForward = native.ButtonForward
+)
+
+// Rect is the position and size of a display in desktop coordinates
+type Rect = native.Rect
+
+// ParseButton returns the button with the given name
+// ("left", "right", "middle", "back" or "forward")
+func ParseButton(name string) (Button, error) {
+	return native.ParseButton(name)
+}
+
 type MouseState int
 
 const (
@@ -33,12 +65,18 @@ type Config struct {
 	// Silent disables logging to stdout
 	Silent bool
 	
-	// Stabilization holds the stabilization options
+	// Stabilization holds the initial stabilization options, nil disables
+	// stabilization. Change them with Controller.UpdateStabilization.
 	Stabilization *StabilizationOptions
 	
-	// screenWidth and screenHeight cache the screen dimensions
+	// Acceleration scales movements by the pointer velocity, nil disables it
+	Acceleration AccelProfile
+	
+	// screenWidth and screenHeight cache the primary display dimensions
 	screenWidth  int
 	screenHeight int
+	// displays caches the desktop layout, primary first
+	displays []Rect
 	// mutex for thread-safety
 	mu sync.RWMutex
 }
@@ -57,185 +95,506 @@ func (c *Config) ScreenHeight() int {
 	return c.screenHeight
 }
 
-// DefaultConfig returns a default configuration
+// Displays returns the cached display layout, primary first
+func (c *Config) Displays() []Rect {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]Rect(nil), c.displays...)
+}
+
+// DefaultConfig returns a default configuration.
+// The screen dimensions are filled in from the backend by NewController.
 func DefaultConfig() *Config {
-	w, h := native.GetScreenSize()
 	return &Config{
 		SpeedFactor:   1.0,
 		EnforceBounds: true,
 		Silent:        false,
-		screenWidth:   w,
-		screenHeight:  h,
 		Stabilization: DefaultStabilizationOptions(),
 	}
 }
 
+var (
+	// sharedBackend is the platform backend used by controllers created without one
+	sharedBackend     Backend
+	sharedBackendOnce sync.Once
+)
+
+// DefaultBackend returns the platform's preferred backend, opened once and
+// shared by every controller created without an explicit backend.
+// Falls back to the null backend if the platform backend can't be opened.
+func DefaultBackend() Backend {
+	sharedBackendOnce.Do(func() {
+		backend, err := native.Open("")
+		if err != nil {
+			fmt.Printf("Could not open a mouse backend, mouse events will be dropped: %v\n", err)
+			backend = native.NewNull()
+		}
+		sharedBackend = backend
+	})
+	return sharedBackend
+}
+
 // Controller manages mouse interactions with configurable behavior
 type Controller struct {
-	config *Config
+	config  *Config
+	backend Backend
+	
+	// residualX and residualY hold the sub-pixel motion not applied yet
+	residualX float64
+	residualY float64
+	// velocity estimates the input velocity for acceleration
+	velocity velocityTracker
+	// confine is the index of the display the cursor is kept on, -1 for none
+	confine int
+	// stabilization holds the current stabilization options, nil when
+	// disabled. They are replaced as a whole, never modified.
+	stabilization atomic.Pointer[StabilizationOptions]
+	// stabilizer is the filter state of moves without their own
+	stabilizer *Stabilizer
+	// motionMu serializes moves, which update the residual, the velocity
+	// and the stabilization state, and guards confine
+	motionMu sync.Mutex
 }
 
-// NewController creates a new mouse controller with the given configuration
-func NewController(config *Config) *Controller {
+// NewController creates a new mouse controller with the given configuration,
+// injecting events through backend. A nil backend selects DefaultBackend.
+func NewController(config *Config, backend Backend) *Controller {
 	if config == nil {
 		config = DefaultConfig()
 	}
-	return &Controller{
-		config: config,
+	if backend == nil {
+		backend = DefaultBackend()
+	}
+
+	config.mu.Lock()
+	if config.screenWidth == 0 || config.screenHeight == 0 {
+		config.screenWidth, config.screenHeight = backend.GetScreenSize()
 	}
+	if len(config.displays) == 0 {
+		config.displays = backend.Displays()
+	}
+	config.mu.Unlock()
+
+	c := &Controller{
+		config:     config,
+		backend:    backend,
+		confine:    -1,
+		stabilizer: NewStabilizer(),
+	}
+	c.UpdateStabilization(config.Stabilization)
+	return c
+}
+
+// Backend returns the backend the controller injects events through
+func (c *Controller) Backend() Backend {
+	return c.backend
 }
 
 // Move moves the mouse cursor by the given delta amounts,
-// applying speed factor and bounds checking according to configuration
-func (c *Controller) Move(deltaX, deltaY int) {
+// applying speed factor and bounds checking according to configuration.
+// Fractional deltas are accumulated, so slow movements still add up to
+// whole pixels over several calls.
+func (c *Controller) Move(deltaX, deltaY float64) error {
+	return c.MoveWith(c.stabilizer, deltaX, deltaY)
+}
+
+// MoveWith moves the mouse cursor like Move, keeping the stabilization
+// filter state in stabilizer. Each input stream has its own, so the
+// movements of one phone don't disturb the filtering of another's.
+func (c *Controller) MoveWith(stabilizer *Stabilizer, deltaX, deltaY float64) error {
+	if math.IsNaN(deltaX) || math.IsNaN(deltaY) || math.IsInf(deltaX, 0) || math.IsInf(deltaY, 0) {
+		return fmt.Errorf("invalid movement: %g,%g", deltaX, deltaY)
+	}
+	
+	c.motionMu.Lock()
+	defer c.motionMu.Unlock()
+	
 	c.config.mu.RLock()
 	defer c.config.mu.RUnlock()
 	
 	// Apply stabilization if enabled
-	if c.config.Stabilization != nil {
-		stabilizedX, stabilizedY, shouldMove := c.config.Stabilization.ProcessMovement(deltaX, deltaY)
+	if options := c.stabilization.Load(); options != nil {
+		stabilizedX, stabilizedY, shouldMove := stabilizer.ProcessMovement(options, deltaX, deltaY)
 		if !shouldMove {
-			return
+			return nil
 		}
 		deltaX, deltaY = stabilizedX, stabilizedY
 	}
 	
-	// Apply speed factor
-	adjustedDeltaX := int(float64(deltaX) * c.config.SpeedFactor)
-	adjustedDeltaY := int(float64(deltaY) * c.config.SpeedFactor)
+	// Apply acceleration
+	gain := 1.0
+	if c.config.Acceleration != nil {
+		velocity := c.velocity.update(deltaX, deltaY, time.Now())
+		gain = c.config.Acceleration.Gain(velocity)
+	}
+	
+	// Apply speed factor, carrying the sub-pixel part over to the next move
+	scaledX := deltaX*c.config.SpeedFactor*gain + c.residualX
+	scaledY := deltaY*c.config.SpeedFactor*gain + c.residualY
+	adjustedDeltaX := int(scaledX)
+	adjustedDeltaY := int(scaledY)
+	c.residualX = scaledX - float64(adjustedDeltaX)
+	c.residualY = scaledY - float64(adjustedDeltaY)
+	
+	if adjustedDeltaX == 0 && adjustedDeltaY == 0 {
+		return nil
+	}
 	
 	// Get current position
-	currentX, currentY := native.GetMousePosition()
+	currentX, currentY := c.backend.GetMousePosition()
 	
 	// Calculate new position
 	newX := currentX + adjustedDeltaX
 	newY := currentY + adjustedDeltaY
 	
-	// Enforce screen boundaries if configured
-	if c.config.EnforceBounds {
-		if newX < 0 {
-			newX = 0
-		} else if newX >= c.config.screenWidth {
-			newX = c.config.screenWidth - 1
-		}
-		
-		if newY < 0 {
-			newY = 0
-		} else if newY >= c.config.screenHeight {
-			newY = c.config.screenHeight - 1
-		}
+	// Keep the cursor on the confining display, or on the desktop if
+	// bounds are enforced. Gaps between displays of different sizes are
+	// out of bounds too. Motion pushing against an edge is dropped rather
+	// than accumulated.
+	clampedX, clampedY := newX, newY
+	if c.confine >= 0 && c.confine < len(c.config.displays) {
+		clampedX, clampedY = c.config.displays[c.confine].Clamp(newX, newY)
+	} else if c.config.EnforceBounds {
+		clampedX, clampedY = native.ClampToDisplays(c.config.displays, newX, newY)
 	}
+	if clampedX != newX {
+		c.residualX = 0
+	}
+	if clampedY != newY {
+		c.residualY = 0
+	}
+	newX, newY = clampedX, clampedY
 	
 	// Move the mouse
-	native.MoveAbsolute(newX, newY)
+	if err := c.backend.MoveAbsolute(newX, newY); err != nil {
+		return err
+	}
 	
 	// Log the movement if not silent
 	if !c.config.Silent {
-		fmt.Printf("Moved mouse to: %d,%d (delta: %d,%d, adjusted: %d,%d)\n", 
+		fmt.Printf("Moved mouse to: %d,%d (delta: %g,%g, adjusted: %d,%d)\n", 
 			newX, newY, deltaX, deltaY, adjustedDeltaX, adjustedDeltaY)
 	}
+
+	return nil
 }
 
-// SetLeftButton sets the left mouse button state
-func (c *Controller) SetLeftButton(state MouseState) {
+// SetButton presses or releases a mouse button
+func (c *Controller) SetButton(button Button, state MouseState) error {
 	c.config.mu.RLock()
 	defer c.config.mu.RUnlock()
 	
 	if state == Down {
-		native.LeftDown()
+		if err := c.backend.ButtonDown(button); err != nil {
+			return err
+		}
 		if !c.config.Silent {
-			fmt.Println("Left mouse button down")
+			fmt.Printf("Mouse button %s down\n", button)
 		}
 	} else {
-		native.LeftUp()
+		if err := c.backend.ButtonUp(button); err != nil {
+			return err
+		}
 		if !c.config.Silent {
-			fmt.Println("Left mouse button up")
+			fmt.Printf("Mouse button %s up\n", button)
 		}
 	}
+	
+	return nil
+}
+
+// SetLeftButton sets the left mouse button state
+func (c *Controller) SetLeftButton(state MouseState) error {
+	return c.SetButton(ButtonLeft, state)
 }
 
 // SetRightButton sets the right mouse button state
-func (c *Controller) SetRightButton(state MouseState) {
+func (c *Controller) SetRightButton(state MouseState) error {
+	return c.SetButton(ButtonRight, state)
+}
+
+// ClickButton presses and releases a mouse button
+func (c *Controller) ClickButton(button Button) error {
 	c.config.mu.RLock()
 	defer c.config.mu.RUnlock()
 	
-	if state == Down {
-		native.RightDown()
-		if !c.config.Silent {
-			fmt.Println("Right mouse button down")
-		}
-	} else {
-		native.RightUp()
-		if !c.config.Silent {
-			fmt.Println("Right mouse button up")
-		}
+	if err := c.backend.Click(button); err != nil {
+		return err
+	}
+	if !c.config.Silent {
+		fmt.Printf("Mouse button %s click\n", button)
 	}
+	
+	return nil
 }
 
-// Click performs a mouse click of the specified type
-func (c *Controller) Click(clickType ClickType) error {
+// DoubleClickButton clicks a mouse button twice in quick succession
+func (c *Controller) DoubleClickButton(button Button) error {
 	c.config.mu.RLock()
 	defer c.config.mu.RUnlock()
 	
-	switch clickType {
-	case LeftClick:
-		native.LeftClick()
-		if !c.config.Silent {
-			fmt.Println("Left mouse click")
-		}
-	case RightClick:
-		native.RightClick()
+	if err := c.backend.DoubleClick(button); err != nil {
+		return err
+	}
+	if !c.config.Silent {
+		fmt.Printf("Mouse button %s double click\n", button)
+	}
+	
+	return nil
+}
+
+// Click performs a mouse click of the specified type
+func (c *Controller) Click(clickType ClickType) error {
+	if clickType == DoubleClick {
+		return c.DoubleClickButton(ButtonLeft)
+	}
+	
+	button, err := ParseButton(string(clickType))
+	if err != nil {
+		err = fmt.Errorf("unknown click type: %s", clickType)
 		if !c.config.Silent {
-			fmt.Println("Right mouse click")
+			fmt.Println(err)
 		}
-	case DoubleClick:
-		native.DoubleClick()
-		if !c.config.Silent {
-			fmt.Println("Double mouse click")
+		return err
+	}
+	
+	return c.ClickButton(button)
+}
+
+// Scroll scrolls by the given number of wheel detents. Fractional values
+// give smooth scrolling. Positive deltaY scrolls down, positive deltaX right.
+func (c *Controller) Scroll(deltaX, deltaY float64) error {
+	c.config.mu.RLock()
+	defer c.config.mu.RUnlock()
+	
+	if deltaX == 0 && deltaY == 0 {
+		return nil
+	}
+	
+	if err := c.backend.Scroll(deltaX, deltaY); err != nil {
+		return err
+	}
+	
+	if !c.config.Silent {
+		fmt.Printf("Scrolled by %.2f,%.2f\n", deltaX, deltaY)
+	}
+	
+	return nil
+}
+
+// ConfigPatch is a partial update of the controller configuration.
+// Nil fields are left unchanged.
+type ConfigPatch struct {
+	SpeedFactor   *float64
+	EnforceBounds *bool
+	Silent        *bool
+	
+	// Stabilization replaces the stabilization options and enables
+	// stabilization
+	Stabilization *StabilizationOptions
+	// DisableStabilization disables stabilization, Stabilization is ignored
+	DisableStabilization bool
+	
+	// Acceleration replaces the acceleration profile, a LinearProfile
+	// disables acceleration
+	Acceleration AccelProfile
+}
+
+// Validate checks the values the patch sets
+func (p *ConfigPatch) Validate() error {
+	if p.SpeedFactor != nil {
+		if err := validateSpeed(*p.SpeedFactor); err != nil {
+			return err
 		}
-	default:
-		err := fmt.Errorf("unknown click type: %s", clickType)
-		if !c.config.Silent {
-			fmt.Println(err)
+	}
+	if p.Stabilization != nil && !p.DisableStabilization {
+		if err := p.Stabilization.Validate(); err != nil {
+			return err
 		}
+	}
+	return nil
+}
+
+// Validate checks the configuration values
+func (c *Config) Validate() error {
+	if err := validateSpeed(c.SpeedFactor); err != nil {
+		return err
+	}
+	if c.Stabilization != nil {
+		return c.Stabilization.Validate()
+	}
+	return nil
+}
+
+// validateSpeed checks a speed factor
+func validateSpeed(speed float64) error {
+	if math.IsNaN(speed) || math.IsInf(speed, 0) || speed <= 0 {
+		return fmt.Errorf("speed must be positive, got %g", speed)
+	}
+	return nil
+}
+
+// UpdateConfig applies the fields the patch sets, leaving the others
+// unchanged. Nothing is applied if a value is out of range, and moves see
+// either none or all of the changes.
+func (c *Controller) UpdateConfig(patch ConfigPatch) error {
+	if err := patch.Validate(); err != nil {
 		return err
 	}
 	
+	c.config.mu.Lock()
+	defer c.config.mu.Unlock()
+	
+	if patch.SpeedFactor != nil {
+		c.config.SpeedFactor = *patch.SpeedFactor
+	}
+	if patch.EnforceBounds != nil {
+		c.config.EnforceBounds = *patch.EnforceBounds
+	}
+	if patch.Silent != nil {
+		c.config.Silent = *patch.Silent
+	}
+	if patch.DisableStabilization {
+		c.UpdateStabilization(nil)
+	} else if patch.Stabilization != nil {
+		c.UpdateStabilization(patch.Stabilization)
+	}
+	if patch.Acceleration != nil {
+		c.config.Acceleration = patch.Acceleration
+	}
+	
 	return nil
 }
 
-// UpdateConfig updates the controller's configuration
-func (c *Controller) UpdateConfig(config *Config) {
+// RefreshDisplays queries the backend for the current display layout,
+// e.g. after a monitor was plugged in, and returns it
+func (c *Controller) RefreshDisplays() []Rect {
+	c.motionMu.Lock()
+	defer c.motionMu.Unlock()
+	
 	c.config.mu.Lock()
 	defer c.config.mu.Unlock()
 	
-	if config != nil {
-		// Only update fields that are explicitly set in the input config
-		if config.SpeedFactor != 0 {
-			c.config.SpeedFactor = config.SpeedFactor
-		}
-		
-		// For boolean fields, we need to check if they were provided in the input
-		// For now, we just apply them as is, assuming a non-nil config means these fields were set
-		c.config.EnforceBounds = config.EnforceBounds
-		c.config.Silent = config.Silent
-		
-		if config.Stabilization != nil {
-			c.config.Stabilization = config.Stabilization
+	c.config.screenWidth, c.config.screenHeight = c.backend.GetScreenSize()
+	c.config.displays = c.backend.Displays()
+	
+	// The confining display may have been unplugged
+	if c.confine >= len(c.config.displays) {
+		c.confine = -1
+	}
+	
+	return append([]Rect(nil), c.config.displays...)
+}
+
+// ErrNoDisplay is returned for a display index past the last display
+var ErrNoDisplay = errors.New("no display")
+
+// ConfineToDisplay keeps the cursor on the display with the given index
+// (0 is the primary display), moving it there if needed.
+// A negative index lets the cursor move across every display again.
+func (c *Controller) ConfineToDisplay(index int) error {
+	c.motionMu.Lock()
+	defer c.motionMu.Unlock()
+	
+	c.config.mu.RLock()
+	defer c.config.mu.RUnlock()
+	
+	if index < 0 {
+		c.confine = -1
+		if !c.config.Silent {
+			fmt.Println("Pointer released from display")
 		}
-		
-		if c.config.screenWidth == 0 || c.config.screenHeight == 0 {
-			c.config.screenWidth, c.config.screenHeight = native.GetScreenSize()
+		return nil
+	}
+	if index >= len(c.config.displays) {
+		return fmt.Errorf("%w %d, there are %d", ErrNoDisplay, index, len(c.config.displays))
+	}
+	
+	c.confine = index
+	display := c.config.displays[index]
+	
+	if x, y := c.backend.GetMousePosition(); !display.Contains(x, y) {
+		if err := c.backend.MoveAbsolute(display.X+display.Width/2, display.Y+display.Height/2); err != nil {
+			return err
 		}
 	}
+	
+	if !c.config.Silent {
+		fmt.Printf("Pointer confined to display %d (%s)\n", index, display)
+	}
+	return nil
+}
+
+// State is a snapshot of the controller settings
+type State struct {
+	SpeedFactor   float64
+	EnforceBounds bool
+	// Acceleration is the acceleration profile spec, "linear" when disabled
+	Acceleration  string
+	Stabilization bool
+	// ConfinedDisplay is the index of the display the cursor is kept on, -1 for none
+	ConfinedDisplay int
+	Displays        []Rect
+}
+
+// State returns a snapshot of the controller settings
+func (c *Controller) State() State {
+	c.motionMu.Lock()
+	defer c.motionMu.Unlock()
+	
+	c.config.mu.RLock()
+	defer c.config.mu.RUnlock()
+	
+	state := State{
+		SpeedFactor:     c.config.SpeedFactor,
+		EnforceBounds:   c.config.EnforceBounds,
+		Acceleration:    "linear",
+		Stabilization:   c.stabilization.Load() != nil,
+		ConfinedDisplay: c.confine,
+		Displays:        append([]Rect(nil), c.config.displays...),
+	}
+	if c.config.Acceleration != nil {
+		state.Acceleration = FormatAccelProfile(c.config.Acceleration)
+	}
+	return state
 }
 
-// UpdateStabilization updates the stabilization options for the controller
+// Displays returns the cached display layout, primary first
+func (c *Controller) Displays() []Rect {
+	return c.config.Displays()
+}
+
+// UpdateStabilization replaces the stabilization options, nil disables
+// stabilization. The options are copied, moves in progress finish with
+// the old ones.
 func (c *Controller) UpdateStabilization(options *StabilizationOptions) {
+	if options == nil {
+		c.stabilization.Store(nil)
+		return
+	}
+	
+	copied := *options
+	c.stabilization.Store(&copied)
+}
+
+// Stabilization returns a copy of the current stabilization options, nil
+// when stabilization is disabled
+func (c *Controller) Stabilization() *StabilizationOptions {
+	options := c.stabilization.Load()
+	if options == nil {
+		return nil
+	}
+	
+	copied := *options
+	return &copied
+}
+
+// UpdateAcceleration replaces the acceleration profile, nil disables acceleration
+func (c *Controller) UpdateAcceleration(profile AccelProfile) {
 	c.config.mu.Lock()
 	defer c.config.mu.Unlock()
 	
-	c.config.Stabilization = options
+	c.config.Acceleration = profile
 }
 
 // For backward compatibility with existing code
@@ -244,29 +603,39 @@ var defaultController *Controller
 // lazily initialize the default controller
 func getDefaultController() *Controller {
 	if defaultController == nil {
-		defaultController = NewController(DefaultConfig())
+		defaultController = NewController(DefaultConfig(), nil)
 	}
 	return defaultController
 }
 
 // Move uses the default controller to move the mouse
-func Move(deltaX, deltaY int) {
-	getDefaultController().Move(deltaX, deltaY)
+func Move(deltaX, deltaY float64) error {
+	return getDefaultController().Move(deltaX, deltaY)
 }
 
 // Click uses the default controller to perform a click
-func Click(clickType string) {
-	getDefaultController().Click(ClickType(clickType))
+func Click(clickType string) error {
+	return getDefaultController().Click(ClickType(clickType))
 }
 
 // SetLeftButton uses the default controller to set the left mouse button state
-func SetLeftButton(state MouseState) {
-	getDefaultController().SetLeftButton(state)
+func SetLeftButton(state MouseState) error {
+	return getDefaultController().SetLeftButton(state)
 }
 
 // SetRightButton uses the default controller to set the right mouse button state
-func SetRightButton(state MouseState) {
-	getDefaultController().SetRightButton(state)
+func SetRightButton(state MouseState) error {
+	return getDefaultController().SetRightButton(state)
+}
+
+// SetButton uses the default controller to press or release a mouse button
+func SetButton(button Button, state MouseState) error {
+	return getDefaultController().SetButton(button, state)
+}
+
+// Scroll uses the default controller to scroll
+func Scroll(deltaX, deltaY float64) error {
+	return getDefaultController().Scroll(deltaX, deltaY)
 }
 
 // UpdateStabilization uses the default controller to update the stabilization options
@@ -0,0 +1,147 @@
+package native
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Keyboard injects keyboard events into the operating system
+type Keyboard interface {
+	// KeyDown presses and holds a key
+	KeyDown(key Key) error
+	// KeyUp releases a key
+	KeyUp(key Key) error
+	// TypeRune types a single Unicode character. Backends that can't inject
+	// Unicode directly fall back to the US keyboard layout and return an
+	// error for characters it can't produce.
+	TypeRune(r rune) error
+}
+
+// Capabilities describes what a backend can inject
+type Capabilities struct {
+	// Keyboard is set when key events can be injected
+	Keyboard bool
+	// Unicode is set when TypeRune can type any character, rather than
+	// only those of the US keyboard layout
+	Unicode bool
+	// Scroll is set when wheel events can be injected
+	Scroll bool
+	// SmoothScroll is set when fractions of a detent reach applications
+	// as such, rather than being accumulated into whole detents
+	SmoothScroll bool
+	// MultiMonitor is set when Displays reports the real monitor layout
+	MultiMonitor bool
+	// Buttons lists the mouse buttons that can be pressed
+	Buttons []Button
+}
+
+// allButtons lists every button, for backends supporting all of them
+var allButtons = []Button{ButtonLeft, ButtonRight, ButtonMiddle, ButtonBack, ButtonForward}
+
+// Backend injects mouse and keyboard events into the operating system.
+// Each platform provides its own implementation, and several can be
+// available at once (e.g. uinput and null on Linux).
+type Backend interface {
+	Keyboard
+
+	// MoveAbsolute moves the mouse cursor to the specified absolute coordinates
+	MoveAbsolute(x, y int) error
+	// MoveRelative moves the mouse cursor by the specified delta values
+	MoveRelative(deltaX, deltaY int) error
+
+	// ButtonDown presses and holds a button
+	ButtonDown(button Button) error
+	// ButtonUp releases a button
+	ButtonUp(button Button) error
+	// Click presses and releases a button
+	Click(button Button) error
+	// DoubleClick clicks a button twice in quick succession
+	DoubleClick(button Button) error
+
+	// Scroll scrolls by the given number of wheel detents. Fractional values
+	// are supported for smooth, touchpad-style scrolling. Positive deltaY
+	// scrolls down and positive deltaX scrolls right.
+	Scroll(deltaX, deltaY float64) error
+
+	// GetScreenSize returns the primary display dimensions
+	GetScreenSize() (width, height int)
+	// Displays returns every display of the desktop, primary first.
+	// The cursor can be anywhere on their union.
+	Displays() []Rect
+	// GetMousePosition returns the current mouse cursor position
+	GetMousePosition() (x, y int)
+
+	// Name returns the name the backend is registered under
+	Name() string
+	// Capabilities describes what the backend can inject
+	Capabilities() Capabilities
+
+	// Close releases any resources held by the backend
+	Close() error
+}
+
+// Factory creates a new backend instance
+type Factory func() (Backend, error)
+
+var (
+	registry      = map[string]Factory{}
+	registryMutex sync.RWMutex
+)
+
+// Register makes a backend available under the given name
+func Register(name string, factory Factory) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	registry[name] = factory
+}
+
+// Available returns the names of all registered backends
+func Available() []string {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DefaultName returns the name of the preferred backend for this platform
+func DefaultName() string {
+	return platformBackends[0]
+}
+
+// Open creates the backend registered under name.
+// An empty name tries the platform's backends in order of preference
+// and returns the first one that opens.
+func Open(name string) (Backend, error) {
+	if name != "" {
+		return open(name)
+	}
+
+	var errs []error
+	for _, name := range platformBackends {
+		backend, err := open(name)
+		if err == nil {
+			return backend, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", name, err))
+	}
+	return nil, errors.Join(errs...)
+}
+
+func open(name string) (Backend, error) {
+	registryMutex.RLock()
+	factory, ok := registry[name]
+	registryMutex.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown backend %q (available: %v)", name, Available())
+	}
+	return factory()
+}
@@ -0,0 +1,42 @@
+package native
+
+import "fmt"
+
+// Button identifies a mouse button
+type Button int
+
+const (
+	ButtonLeft Button = iota
+	ButtonRight
+	ButtonMiddle
+	// ButtonBack is the side button browsers use to go back
+	ButtonBack
+	// ButtonForward is the side button browsers use to go forward
+	ButtonForward
+)
+
+var buttonNames = map[Button]string{
+	ButtonLeft:    "left",
+	ButtonRight:   "right",
+	ButtonMiddle:  "middle",
+	ButtonBack:    "back",
+	ButtonForward: "forward",
+}
+
+func (b Button) String() string {
+	if name, ok := buttonNames[b]; ok {
+		return name
+	}
+	return fmt.Sprintf("button%d", int(b))
+}
+
+// ParseButton returns the button with the given name
+// ("left", "right", "middle", "back" or "forward")
+func ParseButton(name string) (Button, error) {
+	for button, buttonName := range buttonNames {
+		if buttonName == name {
+			return button, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown mouse button: %s", name)
+}
@@ -0,0 +1,61 @@
+package native
+
+import "fmt"
+
+// Rect is the position and size of a display in desktop coordinates.
+// The primary display usually sits at 0,0, so displays left of or above
+// it have negative origins.
+type Rect struct {
+	X      int
+	Y      int
+	Width  int
+	Height int
+}
+
+// String formats the rect like an X geometry, e.g. "2560x1440-2560+0"
+func (r Rect) String() string {
+	return fmt.Sprintf("%dx%d%+d%+d", r.Width, r.Height, r.X, r.Y)
+}
+
+// Contains reports whether the point lies on the display
+func (r Rect) Contains(x, y int) bool {
+	return x >= r.X && x < r.X+r.Width && y >= r.Y && y < r.Y+r.Height
+}
+
+// Clamp returns the point on the display closest to x,y
+func (r Rect) Clamp(x, y int) (int, int) {
+	if x < r.X {
+		x = r.X
+	} else if x >= r.X+r.Width {
+		x = r.X + r.Width - 1
+	}
+	if y < r.Y {
+		y = r.Y
+	} else if y >= r.Y+r.Height {
+		y = r.Y + r.Height - 1
+	}
+	return x, y
+}
+
+// ClampToDisplays returns the point closest to x,y lying on one of the
+// displays. Points already on a display, or any point when there are no
+// displays, are returned unchanged.
+func ClampToDisplays(displays []Rect, x, y int) (int, int) {
+	if len(displays) == 0 {
+		return x, y
+	}
+
+	bestX, bestY, bestDistance := x, y, -1
+	for _, display := range displays {
+		if display.Contains(x, y) {
+			return x, y
+		}
+
+		clampedX, clampedY := display.Clamp(x, y)
+		distance := (clampedX-x)*(clampedX-x) + (clampedY-y)*(clampedY-y)
+		if bestDistance < 0 || distance < bestDistance {
+			bestX, bestY, bestDistance = clampedX, clampedY, distance
+		}
+	}
+	return bestX, bestY
+}
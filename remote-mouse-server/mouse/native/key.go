@@ -0,0 +1,243 @@
+package native
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Key identifies a physical key in a layout-independent way.
+// Each backend maps keys to its own key codes.
+type Key int
+
+const (
+	KeyA Key = iota + 1
+	KeyB
+	KeyC
+	KeyD
+	KeyE
+	KeyF
+	KeyG
+	KeyH
+	KeyI
+	KeyJ
+	KeyK
+	KeyL
+	KeyM
+	KeyN
+	KeyO
+	KeyP
+	KeyQ
+	KeyR
+	KeyS
+	KeyT
+	KeyU
+	KeyV
+	KeyW
+	KeyX
+	KeyY
+	KeyZ
+
+	Key0
+	Key1
+	Key2
+	Key3
+	Key4
+	Key5
+	Key6
+	Key7
+	Key8
+	Key9
+
+	KeyF1
+	KeyF2
+	KeyF3
+	KeyF4
+	KeyF5
+	KeyF6
+	KeyF7
+	KeyF8
+	KeyF9
+	KeyF10
+	KeyF11
+	KeyF12
+
+	KeyEnter
+	KeyEscape
+	KeyBackspace
+	KeyTab
+	KeySpace
+	KeyMinus
+	KeyEqual
+	KeyLeftBracket
+	KeyRightBracket
+	KeyBackslash
+	KeySemicolon
+	KeyApostrophe
+	KeyGrave
+	KeyComma
+	KeyPeriod
+	KeySlash
+	KeyCapsLock
+
+	KeyInsert
+	KeyDelete
+	KeyHome
+	KeyEnd
+	KeyPageUp
+	KeyPageDown
+	KeyUp
+	KeyDown
+	KeyLeft
+	KeyRight
+
+	KeyShift
+	KeyCtrl
+	KeyAlt
+	// KeyMeta is the Windows key on PCs and Command on Macs
+	KeyMeta
+
+	KeyPrintScreen
+	KeyVolumeUp
+	KeyVolumeDown
+	KeyMute
+	KeyPlayPause
+	KeyNextTrack
+	KeyPrevTrack
+)
+
+// keyNames holds the canonical name of every key
+var keyNames = map[Key]string{
+	KeyEnter:        "enter",
+	KeyEscape:       "escape",
+	KeyBackspace:    "backspace",
+	KeyTab:          "tab",
+	KeySpace:        "space",
+	KeyMinus:        "minus",
+	KeyEqual:        "equal",
+	KeyLeftBracket:  "leftbracket",
+	KeyRightBracket: "rightbracket",
+	KeyBackslash:    "backslash",
+	KeySemicolon:    "semicolon",
+	KeyApostrophe:   "apostrophe",
+	KeyGrave:        "grave",
+	KeyComma:        "comma",
+	KeyPeriod:       "period",
+	KeySlash:        "slash",
+	KeyCapsLock:     "capslock",
+	KeyInsert:       "insert",
+	KeyDelete:       "delete",
+	KeyHome:         "home",
+	KeyEnd:          "end",
+	KeyPageUp:       "pageup",
+	KeyPageDown:     "pagedown",
+	KeyUp:           "up",
+	KeyDown:         "down",
+	KeyLeft:         "left",
+	KeyRight:        "right",
+	KeyShift:        "shift",
+	KeyCtrl:         "ctrl",
+	KeyAlt:          "alt",
+	KeyMeta:         "meta",
+	KeyPrintScreen:  "printscreen",
+	KeyVolumeUp:     "volumeup",
+	KeyVolumeDown:   "volumedown",
+	KeyMute:         "mute",
+	KeyPlayPause:    "playpause",
+	KeyNextTrack:    "nexttrack",
+	KeyPrevTrack:    "prevtrack",
+}
+
+// keyAliases holds alternative names accepted by ParseKey
+var keyAliases = map[string]Key{
+	"return":  KeyEnter,
+	"esc":     KeyEscape,
+	"del":     KeyDelete,
+	"control": KeyCtrl,
+	"option":  KeyAlt,
+	"super":   KeyMeta,
+	"win":     KeyMeta,
+	"cmd":     KeyMeta,
+	"command": KeyMeta,
+	"quote":   KeyApostrophe,
+	"pgup":    KeyPageUp,
+	"pgdn":    KeyPageDown,
+}
+
+func init() {
+	for i := 0; i < 26; i++ {
+		keyNames[KeyA+Key(i)] = string(rune('a' + i))
+	}
+	for i := 0; i < 10; i++ {
+		keyNames[Key0+Key(i)] = string(rune('0' + i))
+	}
+	for i := 0; i < 12; i++ {
+		keyNames[KeyF1+Key(i)] = fmt.Sprintf("f%d", i+1)
+	}
+}
+
+func (k Key) String() string {
+	if name, ok := keyNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("key%d", int(k))
+}
+
+// IsModifier reports whether the key is shift, ctrl, alt or meta
+func (k Key) IsModifier() bool {
+	return k == KeyShift || k == KeyCtrl || k == KeyAlt || k == KeyMeta
+}
+
+// ParseKey returns the key with the given name, e.g. "a", "f5", "enter" or "ctrl".
+// Names are case-insensitive.
+func ParseKey(name string) (Key, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if key, ok := keyAliases[name]; ok {
+		return key, nil
+	}
+	for key, keyName := range keyNames {
+		if keyName == name {
+			return key, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown key: %s", name)
+}
+
+// usLayoutShifted maps the characters typed with shift on a US keyboard
+// to their unshifted counterpart
+var usLayoutShifted = map[rune]rune{
+	'!': '1', '@': '2', '#': '3', '$': '4', '%': '5',
+	'^': '6', '&': '7', '*': '8', '(': '9', ')': '0',
+	'_': '-', '+': '=', '{': '[', '}': ']', '|': '\\',
+	':': ';', '"': '\'', '~': '`', '<': ',', '>': '.', '?': '/',
+}
+
+// usLayoutKeys maps unshifted punctuation and whitespace on a US keyboard to keys
+var usLayoutKeys = map[rune]Key{
+	'-': KeyMinus, '=': KeyEqual, '[': KeyLeftBracket, ']': KeyRightBracket,
+	'\\': KeyBackslash, ';': KeySemicolon, '\'': KeyApostrophe, '`': KeyGrave,
+	',': KeyComma, '.': KeyPeriod, '/': KeySlash,
+	' ': KeySpace, '\t': KeyTab, '\n': KeyEnter,
+}
+
+// usLayout returns the key (and whether shift is needed) that types r
+// on a US keyboard. Backends that can't inject Unicode directly use it
+// to type text.
+func usLayout(r rune) (key Key, shift bool, ok bool) {
+	switch {
+	case r >= 'a' && r <= 'z':
+		return KeyA + Key(r-'a'), false, true
+	case r >= 'A' && r <= 'Z':
+		return KeyA + Key(r-'A'), true, true
+	case r >= '0' && r <= '9':
+		return Key0 + Key(r-'0'), false, true
+	}
+
+	if unshifted, isShifted := usLayoutShifted[r]; isShifted {
+		r, shift = unshifted, true
+		if r >= '0' && r <= '9' {
+			return Key0 + Key(r-'0'), true, true
+		}
+	}
+	key, ok = usLayoutKeys[r]
+	return key, shift, ok
+}
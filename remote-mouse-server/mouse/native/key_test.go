@@ -0,0 +1,67 @@
+package native
+
+import "testing"
+
+func TestUSLayout(t *testing.T) {
+	tests := []struct {
+		r     rune
+		key   Key
+		shift bool
+		ok    bool
+	}{
+		{r: 'a', key: KeyA, ok: true},
+		{r: 'Z', key: KeyZ, shift: true, ok: true},
+		{r: '0', key: Key0, ok: true},
+		{r: '!', key: Key1, shift: true, ok: true},
+		{r: ')', key: Key0, shift: true, ok: true},
+		{r: '-', key: KeyMinus, ok: true},
+		{r: '_', key: KeyMinus, shift: true, ok: true},
+		{r: '"', key: KeyApostrophe, shift: true, ok: true},
+		{r: '?', key: KeySlash, shift: true, ok: true},
+		{r: ' ', key: KeySpace, ok: true},
+		{r: '\n', key: KeyEnter, ok: true},
+		{r: 'é'},
+		{r: '€'},
+		{r: 0},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.r), func(t *testing.T) {
+			key, shift, ok := usLayout(test.r)
+			if ok != test.ok {
+				t.Fatalf("ok %v, want %v", ok, test.ok)
+			}
+			if ok && (key != test.key || shift != test.shift) {
+				t.Errorf("key %s shift %v, want %s shift %v", key, shift, test.key, test.shift)
+			}
+		})
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	tests := []struct {
+		name string
+		want Key
+		err  bool
+	}{
+		{name: "a", want: KeyA},
+		{name: "F12", want: KeyF12},
+		{name: "esc", want: KeyEscape},
+		{name: "control", want: KeyCtrl},
+		{name: "", err: true},
+		{name: "key1", err: true},
+		{name: "f13", err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			key, err := ParseKey(test.name)
+			if (err != nil) != test.err {
+				t.Fatalf("error %v, want error %v", err, test.err)
+			}
+			if err == nil && key != test.want {
+				t.Errorf("key %s, want %s", key, test.want)
+			}
+		})
+	}
+}
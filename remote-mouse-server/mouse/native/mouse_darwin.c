@@ -1,91 +1,71 @@
 #include <Cocoa/Cocoa.h>
+#include "mouse_darwin.h"
 
-CGEventRef CreateMouseEvent(CGMouseButton button, CGEventType type, CGPoint position) {
-    CGEventRef event = CGEventCreateMouseEvent(NULL, type, position, button);
-    return event;
-}
-
-void PerformClick(CGMouseButton button, bool doubleClick) {
-    CGEventRef event;
-    CGPoint currentPos = CGEventGetLocation(CGEventCreate(NULL));
-    
-    event = CreateMouseEvent(button, kCGEventLeftMouseDown, currentPos);
-    CGEventPost(kCGHIDEventTap, event);
-    CFRelease(event);
-    
-    event = CreateMouseEvent(button, kCGEventLeftMouseUp, currentPos);
-    CGEventPost(kCGHIDEventTap, event);
-    CFRelease(event);
-    
-    if (doubleClick) {
-        event = CreateMouseEvent(button, kCGEventLeftMouseDown, currentPos);
-        CGEventPost(kCGHIDEventTap, event);
-        CFRelease(event);
-        
-        event = CreateMouseEvent(button, kCGEventLeftMouseUp, currentPos);
-        CGEventPost(kCGHIDEventTap, event);
-        CFRelease(event);
+// PostMouseButton presses or releases a button at the current cursor position.
+// Left and right have their own event types, every other button is an "other" button.
+void PostMouseButton(int button, bool down, int clickCount) {
+    CGEventType type;
+    switch (button) {
+    case kCGMouseButtonLeft:
+        type = down ? kCGEventLeftMouseDown : kCGEventLeftMouseUp;
+        break;
+    case kCGMouseButtonRight:
+        type = down ? kCGEventRightMouseDown : kCGEventRightMouseUp;
+        break;
+    default:
+        type = down ? kCGEventOtherMouseDown : kCGEventOtherMouseUp;
+        break;
     }
-}
-
-void LeftClick(bool doubleClick) {
-    PerformClick(kCGMouseButtonLeft, doubleClick);
-}
-
-void LeftDown() {
-    CGPoint currentPos = CGEventGetLocation(CGEventCreate(NULL));
-    CGEventRef event = CreateMouseEvent(kCGMouseButtonLeft, kCGEventLeftMouseDown, currentPos);
+    
+    CGEventRef event = CGEventCreateMouseEvent(NULL, type, GetMousePosition(), (CGMouseButton)button);
+    CGEventSetIntegerValueField(event, kCGMouseEventClickState, clickCount);
     CGEventPost(kCGHIDEventTap, event);
     CFRelease(event);
 }
 
-void LeftUp() {
-    CGPoint currentPos = CGEventGetLocation(CGEventCreate(NULL));
-    CGEventRef event = CreateMouseEvent(kCGMouseButtonLeft, kCGEventLeftMouseUp, currentPos);
+void MoveMouseAbsolute(int x, int y) {
+    CGPoint point = CGPointMake(x, y);
+    CGEventRef event = CGEventCreateMouseEvent(NULL, kCGEventMouseMoved, point, kCGMouseButtonLeft);
     CGEventPost(kCGHIDEventTap, event);
     CFRelease(event);
 }
 
-void RightClick() {
-    CGPoint currentPos = CGEventGetLocation(CGEventCreate(NULL));
-    
-    CGEventRef event = CreateMouseEvent(kCGMouseButtonRight, kCGEventRightMouseDown, currentPos);
-    CGEventPost(kCGHIDEventTap, event);
+void MoveMouseRelative(int deltaX, int deltaY) {
+    CGEventRef event = CGEventCreate(NULL);
+    CGPoint currentPos = CGEventGetLocation(event);
     CFRelease(event);
     
-    event = CreateMouseEvent(kCGMouseButtonRight, kCGEventRightMouseUp, currentPos);
+    CGPoint newPos = CGPointMake(currentPos.x + deltaX, currentPos.y + deltaY);
+    event = CGEventCreateMouseEvent(NULL, kCGEventMouseMoved, newPos, kCGMouseButtonLeft);
     CGEventPost(kCGHIDEventTap, event);
     CFRelease(event);
 }
 
-void RightDown() {
-    CGPoint currentPos = CGEventGetLocation(CGEventCreate(NULL));
-    CGEventRef event = CreateMouseEvent(kCGMouseButtonRight, kCGEventRightMouseDown, currentPos);
+void ScrollPixels(int vertical, int horizontal) {
+    CGEventRef event = CGEventCreateScrollWheelEvent(NULL, kCGScrollEventUnitPixel, 2, vertical, horizontal);
     CGEventPost(kCGHIDEventTap, event);
     CFRelease(event);
 }
 
-void RightUp() {
-    CGPoint currentPos = CGEventGetLocation(CGEventCreate(NULL));
-    CGEventRef event = CreateMouseEvent(kCGMouseButtonRight, kCGEventRightMouseUp, currentPos);
+void PostKey(int keycode, bool down, uint64_t flags) {
+    CGEventRef event = CGEventCreateKeyboardEvent(NULL, (CGKeyCode)keycode, down);
+    CGEventSetFlags(event, (CGEventFlags)flags);
     CGEventPost(kCGHIDEventTap, event);
     CFRelease(event);
 }
 
-void MoveMouseAbsolute(int x, int y) {
-    CGPoint point = CGPointMake(x, y);
-    CGEventRef event = CGEventCreateMouseEvent(NULL, kCGEventMouseMoved, point, kCGMouseButtonLeft);
+// TypeUnicode types a character by attaching it to a key event, which works
+// whatever the active keyboard layout is
+void TypeUnicode(const UniChar* chars, int length) {
+    CGEventRef event = CGEventCreateKeyboardEvent(NULL, 0, true);
+    CGEventSetFlags(event, 0);
+    CGEventKeyboardSetUnicodeString(event, length, chars);
     CGEventPost(kCGHIDEventTap, event);
     CFRelease(event);
-}
-
-void MoveMouseRelative(int deltaX, int deltaY) {
-    CGEventRef event = CGEventCreate(NULL);
-    CGPoint currentPos = CGEventGetLocation(event);
-    CFRelease(event);
     
-    CGPoint newPos = CGPointMake(currentPos.x + deltaX, currentPos.y + deltaY);
-    event = CGEventCreateMouseEvent(NULL, kCGEventMouseMoved, newPos, kCGMouseButtonLeft);
+    event = CGEventCreateKeyboardEvent(NULL, 0, false);
+    CGEventSetFlags(event, 0);
+    CGEventKeyboardSetUnicodeString(event, length, chars);
     CGEventPost(kCGHIDEventTap, event);
     CFRelease(event);
 }
@@ -96,16 +76,29 @@ void GetScreenSize(int* width, int* height) {
     *height = (int)CGDisplayPixelsHigh(displayID);
 }
 
+// GetDisplays fills rects with x, y, width, height for up to max active
+// displays in global coordinates and returns how many there are.
+// The main display comes first.
+int GetDisplays(int* rects, int max) {
+    CGDirectDisplayID displays[max];
+    uint32_t count = 0;
+    if (CGGetActiveDisplayList(max, displays, &count) != kCGErrorSuccess) {
+        return 0;
+    }
+    
+    for (uint32_t i = 0; i < count; i++) {
+        CGRect bounds = CGDisplayBounds(displays[i]);
+        rects[i*4+0] = (int)bounds.origin.x;
+        rects[i*4+1] = (int)bounds.origin.y;
+        rects[i*4+2] = (int)bounds.size.width;
+        rects[i*4+3] = (int)bounds.size.height;
+    }
+    return (int)count;
+}
+
 CGPoint GetMousePosition() {
     CGEventRef event = CGEventCreate(NULL);
     CGPoint point = CGEventGetLocation(event);
     CFRelease(event);
     return point;
 }
-
-// Helper function to release a CGEventRef, handling the cast to CFTypeRef properly
-void ReleaseEvent(CGEventRef event) {
-    if (event) {
-        CFRelease((CFTypeRef)event);
-    }
-} 
\ No newline at end of file
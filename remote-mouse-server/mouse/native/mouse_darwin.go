@@ -4,7 +4,10 @@
 package native
 
 import (
+	"fmt"
 	"sync"
+	"unicode/utf16"
+	"unsafe"
 )
 
 /*
@@ -14,92 +17,281 @@ import (
 */
 import "C"
 
-var (
-	mouseMutex sync.Mutex
-)
+var platformBackends = []string{"darwin"}
+
+// Darwin is a backend using CoreGraphics events
+type Darwin struct {
+	// wheel carries sub-pixel scroll amounts between calls
+	wheel wheelAccumulator
+	// modifiers holds the event flags of the modifier keys currently held,
+	// CoreGraphics expects them on every key event
+	modifiers C.uint64_t
+
+	mu sync.Mutex
+}
+
+func init() {
+	Register("darwin", func() (Backend, error) {
+		return NewDarwin(), nil
+	})
+}
 
-func MoveAbsolute(x, y int) {
-	mouseMutex.Lock()
-	defer mouseMutex.Unlock()
+// NewDarwin creates a CoreGraphics backend
+func NewDarwin() *Darwin {
+	return &Darwin{}
+}
+
+func (d *Darwin) MoveAbsolute(x, y int) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
 	
 	C.MoveMouseAbsolute(C.int(x), C.int(y))
+	return nil
 }
 
-func MoveRelative(deltaX, deltaY int) {
-	mouseMutex.Lock()
-	defer mouseMutex.Unlock()
+func (d *Darwin) MoveRelative(deltaX, deltaY int) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
 	
 	C.MoveMouseRelative(C.int(deltaX), C.int(deltaY))
+	return nil
 }
 
-func LeftClick() {
-	mouseMutex.Lock()
-	defer mouseMutex.Unlock()
+// darwinButtons maps buttons to CoreGraphics button numbers
+// (kCGMouseButtonLeft, kCGMouseButtonRight, kCGMouseButtonCenter, then the side buttons)
+var darwinButtons = map[Button]C.int{
+	ButtonLeft:    0,
+	ButtonRight:   1,
+	ButtonMiddle:  2,
+	ButtonBack:    3,
+	ButtonForward: 4,
+}
+
+func darwinButton(button Button) (C.int, error) {
+	number, ok := darwinButtons[button]
+	if !ok {
+		return 0, fmt.Errorf("unsupported mouse button: %s", button)
+	}
+	return number, nil
+}
+
+func (d *Darwin) ButtonDown(button Button) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
 	
-	C.LeftClick(C.bool(false))
+	number, err := darwinButton(button)
+	if err != nil {
+		return err
+	}
+	C.PostMouseButton(number, C.bool(true), 1)
+	return nil
 }
 
-func LeftDown() {
-	mouseMutex.Lock()
-	defer mouseMutex.Unlock()
+func (d *Darwin) ButtonUp(button Button) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
 	
-	pos := C.GetMousePosition()
-	event := C.CreateMouseEvent(C.kCGMouseButtonLeft, C.kCGEventLeftMouseDown, pos)
-	C.CGEventPost(C.kCGHIDEventTap, event)
-	C.ReleaseEvent(event)
+	number, err := darwinButton(button)
+	if err != nil {
+		return err
+	}
+	C.PostMouseButton(number, C.bool(false), 1)
+	return nil
 }
 
-func LeftUp() {
-	mouseMutex.Lock()
-	defer mouseMutex.Unlock()
+func (d *Darwin) Click(button Button) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
 	
-	pos := C.GetMousePosition()
-	event := C.CreateMouseEvent(C.kCGMouseButtonLeft, C.kCGEventLeftMouseUp, pos)
-	C.CGEventPost(C.kCGHIDEventTap, event)
-	C.ReleaseEvent(event)
+	number, err := darwinButton(button)
+	if err != nil {
+		return err
+	}
+	C.PostMouseButton(number, C.bool(true), 1)
+	C.PostMouseButton(number, C.bool(false), 1)
+	return nil
 }
 
-func RightClick() {
-	mouseMutex.Lock()
-	defer mouseMutex.Unlock()
+func (d *Darwin) DoubleClick(button Button) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
 	
-	C.RightClick()
+	number, err := darwinButton(button)
+	if err != nil {
+		return err
+	}
+	// macOS only reports a double click if the second click carries a click count of 2
+	C.PostMouseButton(number, C.bool(true), 1)
+	C.PostMouseButton(number, C.bool(false), 1)
+	C.PostMouseButton(number, C.bool(true), 2)
+	C.PostMouseButton(number, C.bool(false), 2)
+	return nil
+}
+
+// pixelsPerDetent converts wheel detents into the pixel units used for
+// smooth scrolling
+const pixelsPerDetent = 10
+
+func (d *Darwin) Scroll(deltaX, deltaY float64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// CoreGraphics counts upward and leftward scrolling as positive
+	pixelsX, pixelsY := d.wheel.steps(-deltaX, -deltaY, pixelsPerDetent)
+	if pixelsX != 0 || pixelsY != 0 {
+		C.ScrollPixels(C.int(pixelsY), C.int(pixelsX))
+	}
+	return nil
+}
+
+// darwinKeys maps keys to macOS virtual key codes (kVK_* in HIToolbox/Events.h)
+var darwinKeys = map[Key]C.int{
+	KeyA: 0x00, KeyB: 0x0b, KeyC: 0x08, KeyD: 0x02, KeyE: 0x0e, KeyF: 0x03, KeyG: 0x05,
+	KeyH: 0x04, KeyI: 0x22, KeyJ: 0x26, KeyK: 0x28, KeyL: 0x25, KeyM: 0x2e, KeyN: 0x2d,
+	KeyO: 0x1f, KeyP: 0x23, KeyQ: 0x0c, KeyR: 0x0f, KeyS: 0x01, KeyT: 0x11, KeyU: 0x20,
+	KeyV: 0x09, KeyW: 0x0d, KeyX: 0x07, KeyY: 0x10, KeyZ: 0x06,
+
+	Key1: 0x12, Key2: 0x13, Key3: 0x14, Key4: 0x15, Key5: 0x17,
+	Key6: 0x16, Key7: 0x1a, Key8: 0x1c, Key9: 0x19, Key0: 0x1d,
+
+	KeyF1: 0x7a, KeyF2: 0x78, KeyF3: 0x63, KeyF4: 0x76, KeyF5: 0x60, KeyF6: 0x61,
+	KeyF7: 0x62, KeyF8: 0x64, KeyF9: 0x65, KeyF10: 0x6d, KeyF11: 0x67, KeyF12: 0x6f,
+
+	KeyEnter:        0x24,
+	KeyEscape:       0x35,
+	KeyBackspace:    0x33,
+	KeyTab:          0x30,
+	KeySpace:        0x31,
+	KeyMinus:        0x1b,
+	KeyEqual:        0x18,
+	KeyLeftBracket:  0x21,
+	KeyRightBracket: 0x1e,
+	KeyBackslash:    0x2a,
+	KeySemicolon:    0x29,
+	KeyApostrophe:   0x27,
+	KeyGrave:        0x32,
+	KeyComma:        0x2b,
+	KeyPeriod:       0x2f,
+	KeySlash:        0x2c,
+	KeyCapsLock:     0x39,
+
+	KeyInsert:   0x72,
+	KeyDelete:   0x75,
+	KeyHome:     0x73,
+	KeyEnd:      0x77,
+	KeyPageUp:   0x74,
+	KeyPageDown: 0x79,
+	KeyUp:       0x7e,
+	KeyDown:     0x7d,
+	KeyLeft:     0x7b,
+	KeyRight:    0x7c,
+
+	KeyShift: 0x38,
+	KeyCtrl:  0x3b,
+	KeyAlt:   0x3a,
+	KeyMeta:  0x37,
+
+	KeyVolumeUp:   0x48,
+	KeyVolumeDown: 0x49,
+	KeyMute:       0x4a,
 }
 
-func RightDown() {
-	mouseMutex.Lock()
-	defer mouseMutex.Unlock()
+// darwinModifierFlags maps modifier keys to their CGEventFlags mask
+var darwinModifierFlags = map[Key]C.uint64_t{
+	KeyShift: 0x00020000,
+	KeyCtrl:  0x00040000,
+	KeyAlt:   0x00080000,
+	KeyMeta:  0x00100000,
+}
+
+func (d *Darwin) KeyDown(key Key) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
 	
-	pos := C.GetMousePosition()
-	event := C.CreateMouseEvent(C.kCGMouseButtonRight, C.kCGEventRightMouseDown, pos)
-	C.CGEventPost(C.kCGHIDEventTap, event)
-	C.ReleaseEvent(event)
+	keycode, ok := darwinKeys[key]
+	if !ok {
+		return fmt.Errorf("unsupported key: %s", key)
+	}
+	d.modifiers |= darwinModifierFlags[key]
+	C.PostKey(keycode, C.bool(true), d.modifiers)
+	return nil
 }
 
-func RightUp() {
-	mouseMutex.Lock()
-	defer mouseMutex.Unlock()
+func (d *Darwin) KeyUp(key Key) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
 	
-	pos := C.GetMousePosition()
-	event := C.CreateMouseEvent(C.kCGMouseButtonRight, C.kCGEventRightMouseUp, pos)
-	C.CGEventPost(C.kCGHIDEventTap, event)
-	C.ReleaseEvent(event)
+	keycode, ok := darwinKeys[key]
+	if !ok {
+		return fmt.Errorf("unsupported key: %s", key)
+	}
+	d.modifiers &^= darwinModifierFlags[key]
+	C.PostKey(keycode, C.bool(false), d.modifiers)
+	return nil
 }
 
-func DoubleClick() {
-	mouseMutex.Lock()
-	defer mouseMutex.Unlock()
+// TypeRune types any Unicode character, independent of the keyboard layout
+func (d *Darwin) TypeRune(r rune) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
 	
-	C.LeftClick(C.bool(true))
+	chars := utf16.Encode([]rune{r})
+	C.TypeUnicode((*C.UniChar)(unsafe.Pointer(&chars[0])), C.int(len(chars)))
+	return nil
 }
 
-func GetScreenSize() (width, height int) {
+func (d *Darwin) GetScreenSize() (width, height int) {
 	var w, h C.int
 	C.GetScreenSize(&w, &h)
 	return int(w), int(h)
 }
 
-func GetMousePosition() (x, y int) {
+// maxDisplays is the most displays Displays reports
+const maxDisplays = 16
+
+// Displays returns the active displays in global coordinates, main display first
+func (d *Darwin) Displays() []Rect {
+	var rects [maxDisplays * 4]C.int
+	count := int(C.GetDisplays(&rects[0], maxDisplays))
+	
+	if count == 0 {
+		width, height := d.GetScreenSize()
+		return []Rect{{Width: width, Height: height}}
+	}
+	
+	displays := make([]Rect, count)
+	for i := range displays {
+		displays[i] = Rect{
+			X:      int(rects[i*4]),
+			Y:      int(rects[i*4+1]),
+			Width:  int(rects[i*4+2]),
+			Height: int(rects[i*4+3]),
+		}
+	}
+	return displays
+}
+
+func (d *Darwin) GetMousePosition() (x, y int) {
 	pos := C.GetMousePosition()
 	return int(pos.x), int(pos.y)
-} 
\ No newline at end of file
+}
+
+func (d *Darwin) Name() string {
+	return "darwin"
+}
+
+// Capabilities reports full support, scrolling is by pixels
+func (d *Darwin) Capabilities() Capabilities {
+	return Capabilities{
+		Keyboard:     true,
+		Unicode:      true,
+		Scroll:       true,
+		SmoothScroll: true,
+		MultiMonitor: true,
+		Buttons:      allButtons,
+	}
+}
+
+func (d *Darwin) Close() error {
+	return nil
+}
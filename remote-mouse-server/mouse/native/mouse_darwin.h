@@ -3,19 +3,14 @@
 
 #include <Cocoa/Cocoa.h>
 
-CGEventRef CreateMouseEvent(CGMouseButton button, CGEventType type, CGPoint position);
-void PerformClick(CGMouseButton button, bool doubleClick);
-void LeftClick(bool doubleClick);
-void RightClick();
-void LeftDown();
-void LeftUp();
-void RightDown();
-void RightUp();
+void PostMouseButton(int button, bool down, int clickCount);
 void MoveMouseAbsolute(int x, int y);
 void MoveMouseRelative(int deltaX, int deltaY);
+void ScrollPixels(int vertical, int horizontal);
+void PostKey(int keycode, bool down, uint64_t flags);
+void TypeUnicode(const UniChar* chars, int length);
 void GetScreenSize(int* width, int* height);
+int GetDisplays(int* rects, int max);
 CGPoint GetMousePosition();
 
-void ReleaseEvent(CGEventRef event);
-
 #endif 
\ No newline at end of file
@@ -0,0 +1,613 @@
+//go:build linux
+// +build linux
+
+package native
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// The Linux implementation drives a virtual pointer device created through
+// /dev/uinput. Events are injected at the kernel input layer, so they are
+// picked up by X11 and Wayland compositors alike.
+//
+// The device reports absolute coordinates (like the tablet QEMU exposes to
+// guests), which keeps positioning exact regardless of the pointer
+// acceleration configured in the desktop. The kernel offers no way to read
+// the cursor back, so the position is tracked here and starts at the centre
+// of the screen.
+
+// platformBackends lists the Linux backends in order of preference.
+// XTest is the fallback for users without access to /dev/uinput.
+var platformBackends = []string{"uinput", "x11"}
+
+const (
+	uinputPath         = "/dev/uinput"
+	pointerDeviceName  = "remote-mouse virtual pointer"
+	keyboardDeviceName = "remote-mouse virtual keyboard"
+
+	// ioctl requests from linux/uinput.h
+	uiDevCreate  = 0x5501
+	uiDevDestroy = 0x5502
+	uiSetEvBit   = 0x40045564
+	uiSetKeyBit  = 0x40045565
+	uiSetRelBit  = 0x40045566
+	uiSetAbsBit  = 0x40045567
+
+	// Event types and codes from linux/input-event-codes.h
+	evSyn = 0x00
+	evKey = 0x01
+	evRel = 0x02
+	evAbs = 0x03
+
+	synReport = 0x00
+
+	relHWheel      = 0x06
+	relWheel       = 0x08
+	relWheelHiRes  = 0x0b
+	relHWheelHiRes = 0x0c
+
+	// Hi-res wheel events count in fractions of a detent
+	wheelHiResUnit = 120
+
+	absX   = 0x00
+	absY   = 0x01
+	absCnt = 0x40
+
+	btnLeft   = 0x110
+	btnRight  = 0x111
+	btnMiddle = 0x112
+	btnSide   = 0x113
+	btnExtra  = 0x114
+
+	keyLeftShift = 42
+
+	busVirtual = 0x06
+
+	// Fallback used when the display size can't be read from sysfs
+	defaultScreenWidth  = 1920
+	defaultScreenHeight = 1080
+)
+
+// inputEvent mirrors struct input_event
+type inputEvent struct {
+	Time  syscall.Timeval
+	Type  uint16
+	Code  uint16
+	Value int32
+}
+
+// uinputUserDev mirrors struct uinput_user_dev
+type uinputUserDev struct {
+	Name         [80]byte
+	Bustype      uint16
+	Vendor       uint16
+	Product      uint16
+	Version      uint16
+	FFEffectsMax uint32
+	Absmax       [absCnt]int32
+	Absmin       [absCnt]int32
+	Absfuzz      [absCnt]int32
+	Absflat      [absCnt]int32
+}
+
+// Uinput is a backend driving virtual uinput pointer and keyboard devices
+type Uinput struct {
+	pointer  *os.File
+	keyboard *os.File
+
+	screenWidth  int
+	screenHeight int
+	posX         int
+	posY         int
+
+	// wheel carries sub-unit scroll amounts between calls, hiResX/Y carry
+	// hi-res units that don't yet add up to a whole detent
+	wheel  wheelAccumulator
+	hiResX int
+	hiResY int
+
+	mu sync.Mutex
+}
+
+func init() {
+	Register("uinput", func() (Backend, error) {
+		return NewUinput()
+	})
+}
+
+func ioctl(fd uintptr, req, arg uintptr) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, arg); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// ioctlRequest is a single device capability to enable
+type ioctlRequest struct {
+	req, arg uintptr
+}
+
+// createDevice sets up a uinput device with the given capabilities.
+// absmaxX and absmaxY are only used if the device reports absolute axes.
+func createDevice(name string, setup []ioctlRequest, absmaxX, absmaxY int) (*os.File, error) {
+	f, err := os.OpenFile(uinputPath, os.O_WRONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, fmt.Errorf("opening %s: %w", uinputPath, err)
+	}
+
+	fd := f.Fd()
+	for _, s := range setup {
+		if err := ioctl(fd, s.req, s.arg); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("configuring uinput device: %w", err)
+		}
+	}
+
+	var dev uinputUserDev
+	copy(dev.Name[:], name)
+	dev.Bustype = busVirtual
+	dev.Vendor = 0x1
+	dev.Product = 0x1
+	dev.Version = 1
+	dev.Absmax[absX] = int32(absmaxX)
+	dev.Absmax[absY] = int32(absmaxY)
+
+	buf := unsafe.Slice((*byte)(unsafe.Pointer(&dev)), unsafe.Sizeof(dev))
+	if _, err := f.Write(buf); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("writing uinput device description: %w", err)
+	}
+
+	if err := ioctl(fd, uiDevCreate, 0); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("creating uinput device: %w", err)
+	}
+
+	return f, nil
+}
+
+// destroyDevice removes a uinput device from the system
+func destroyDevice(f *os.File) error {
+	ioctl(f.Fd(), uiDevDestroy, 0)
+	return f.Close()
+}
+
+// NewUinput creates the virtual pointer and keyboard devices.
+// Requires write access to /dev/uinput.
+//
+// Keys live on a separate device so desktops classify the pointer as a
+// plain absolute pointer rather than some unusual keyboard.
+func NewUinput() (*Uinput, error) {
+	width, height := screenSize()
+
+	pointer, err := createDevice(pointerDeviceName, []ioctlRequest{
+		{uiSetEvBit, evSyn},
+		{uiSetEvBit, evKey},
+		{uiSetKeyBit, btnLeft},
+		{uiSetKeyBit, btnRight},
+		{uiSetKeyBit, btnMiddle},
+		{uiSetKeyBit, btnSide},
+		{uiSetKeyBit, btnExtra},
+		{uiSetEvBit, evAbs},
+		{uiSetAbsBit, absX},
+		{uiSetAbsBit, absY},
+		{uiSetEvBit, evRel},
+		{uiSetRelBit, relWheel},
+		{uiSetRelBit, relHWheel},
+		{uiSetRelBit, relWheelHiRes},
+		{uiSetRelBit, relHWheelHiRes},
+	}, width-1, height-1)
+	if err != nil {
+		return nil, err
+	}
+
+	keyboardSetup := []ioctlRequest{
+		{uiSetEvBit, evSyn},
+		{uiSetEvBit, evKey},
+	}
+	for _, code := range uinputKeys {
+		keyboardSetup = append(keyboardSetup, ioctlRequest{uiSetKeyBit, uintptr(code)})
+	}
+	keyboard, err := createDevice(keyboardDeviceName, keyboardSetup, 0, 0)
+	if err != nil {
+		destroyDevice(pointer)
+		return nil, err
+	}
+
+	// Give the compositor time to pick up the new devices, otherwise the
+	// first events are dropped
+	time.Sleep(200 * time.Millisecond)
+
+	return &Uinput{
+		pointer:      pointer,
+		keyboard:     keyboard,
+		screenWidth:  width,
+		screenHeight: height,
+		posX:         width / 2,
+		posY:         height / 2,
+	}, nil
+}
+
+// write sends the given events followed by a sync report to device.
+// Must be called with u.mu held.
+func (u *Uinput) write(device *os.File, events ...inputEvent) error {
+	events = append(events, inputEvent{Type: evSyn, Code: synReport})
+
+	size := int(unsafe.Sizeof(inputEvent{}))
+	buf := unsafe.Slice((*byte)(unsafe.Pointer(&events[0])), size*len(events))
+	if _, err := device.Write(buf); err != nil {
+		return fmt.Errorf("uinput write failed: %w", err)
+	}
+	return nil
+}
+
+// moveTo moves the cursor to x,y. Must be called with u.mu held.
+func (u *Uinput) moveTo(x, y int) error {
+	if x < 0 {
+		x = 0
+	} else if x >= u.screenWidth {
+		x = u.screenWidth - 1
+	}
+	if y < 0 {
+		y = 0
+	} else if y >= u.screenHeight {
+		y = u.screenHeight - 1
+	}
+
+	err := u.write(u.pointer,
+		inputEvent{Type: evAbs, Code: absX, Value: int32(x)},
+		inputEvent{Type: evAbs, Code: absY, Value: int32(y)},
+	)
+	if err != nil {
+		return err
+	}
+
+	u.posX, u.posY = x, y
+	return nil
+}
+
+// uinputButtons maps buttons to their kernel key codes. Desktops treat the
+// side and extra buttons as back and forward.
+var uinputButtons = map[Button]uint16{
+	ButtonLeft:    btnLeft,
+	ButtonRight:   btnRight,
+	ButtonMiddle:  btnMiddle,
+	ButtonBack:    btnSide,
+	ButtonForward: btnExtra,
+}
+
+func uinputButton(button Button) (uint16, error) {
+	code, ok := uinputButtons[button]
+	if !ok {
+		return 0, fmt.Errorf("unsupported mouse button: %s", button)
+	}
+	return code, nil
+}
+
+// uinputKeys maps keys to their kernel key codes (KEY_* in linux/input-event-codes.h)
+var uinputKeys = map[Key]uint16{
+	KeyA: 30, KeyB: 48, KeyC: 46, KeyD: 32, KeyE: 18, KeyF: 33, KeyG: 34,
+	KeyH: 35, KeyI: 23, KeyJ: 36, KeyK: 37, KeyL: 38, KeyM: 50, KeyN: 49,
+	KeyO: 24, KeyP: 25, KeyQ: 16, KeyR: 19, KeyS: 31, KeyT: 20, KeyU: 22,
+	KeyV: 47, KeyW: 17, KeyX: 45, KeyY: 21, KeyZ: 44,
+
+	Key1: 2, Key2: 3, Key3: 4, Key4: 5, Key5: 6,
+	Key6: 7, Key7: 8, Key8: 9, Key9: 10, Key0: 11,
+
+	KeyF1: 59, KeyF2: 60, KeyF3: 61, KeyF4: 62, KeyF5: 63, KeyF6: 64,
+	KeyF7: 65, KeyF8: 66, KeyF9: 67, KeyF10: 68, KeyF11: 87, KeyF12: 88,
+
+	KeyEnter:        28,
+	KeyEscape:       1,
+	KeyBackspace:    14,
+	KeyTab:          15,
+	KeySpace:        57,
+	KeyMinus:        12,
+	KeyEqual:        13,
+	KeyLeftBracket:  26,
+	KeyRightBracket: 27,
+	KeyBackslash:    43,
+	KeySemicolon:    39,
+	KeyApostrophe:   40,
+	KeyGrave:        41,
+	KeyComma:        51,
+	KeyPeriod:       52,
+	KeySlash:        53,
+	KeyCapsLock:     58,
+
+	KeyInsert:   110,
+	KeyDelete:   111,
+	KeyHome:     102,
+	KeyEnd:      107,
+	KeyPageUp:   104,
+	KeyPageDown: 109,
+	KeyUp:       103,
+	KeyDown:     108,
+	KeyLeft:     105,
+	KeyRight:    106,
+
+	KeyShift: keyLeftShift,
+	KeyCtrl:  29,
+	KeyAlt:   56,
+	KeyMeta:  125,
+
+	KeyPrintScreen: 99,
+	KeyVolumeUp:    115,
+	KeyVolumeDown:  114,
+	KeyMute:        113,
+	KeyPlayPause:   164,
+	KeyNextTrack:   163,
+	KeyPrevTrack:   165,
+}
+
+func uinputKey(key Key) (uint16, error) {
+	code, ok := uinputKeys[key]
+	if !ok {
+		return 0, fmt.Errorf("unsupported key: %s", key)
+	}
+	return code, nil
+}
+
+// button presses or releases a button. Must be called with u.mu held.
+func (u *Uinput) button(code uint16, down bool) error {
+	value := int32(0)
+	if down {
+		value = 1
+	}
+	return u.write(u.pointer, inputEvent{Type: evKey, Code: code, Value: value})
+}
+
+// click presses and releases a button. Must be called with u.mu held.
+func (u *Uinput) click(code uint16) error {
+	if err := u.button(code, true); err != nil {
+		return err
+	}
+	return u.button(code, false)
+}
+
+// MoveAbsolute moves the mouse cursor to the specified absolute coordinates
+func (u *Uinput) MoveAbsolute(x, y int) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	return u.moveTo(x, y)
+}
+
+// MoveRelative moves the mouse cursor by the specified delta values
+func (u *Uinput) MoveRelative(deltaX, deltaY int) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	return u.moveTo(u.posX+deltaX, u.posY+deltaY)
+}
+
+// ButtonDown performs a mouse button press
+func (u *Uinput) ButtonDown(button Button) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	code, err := uinputButton(button)
+	if err != nil {
+		return err
+	}
+	return u.button(code, true)
+}
+
+// ButtonUp performs a mouse button release
+func (u *Uinput) ButtonUp(button Button) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	code, err := uinputButton(button)
+	if err != nil {
+		return err
+	}
+	return u.button(code, false)
+}
+
+// Click performs a mouse button click
+func (u *Uinput) Click(button Button) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	code, err := uinputButton(button)
+	if err != nil {
+		return err
+	}
+	return u.click(code)
+}
+
+// DoubleClick performs a double click with the given button
+func (u *Uinput) DoubleClick(button Button) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	code, err := uinputButton(button)
+	if err != nil {
+		return err
+	}
+	if err := u.click(code); err != nil {
+		return err
+	}
+	return u.click(code)
+}
+
+// Scroll scrolls by the given number of wheel detents. Hi-res wheel events
+// carry the fractional part, plain wheel events are sent for every whole
+// detent for clients that don't understand hi-res scrolling.
+func (u *Uinput) Scroll(deltaX, deltaY float64) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	// The kernel counts vertical wheel movement away from the user as positive
+	hiX, hiY := u.wheel.steps(deltaX, -deltaY, wheelHiResUnit)
+	if hiX == 0 && hiY == 0 {
+		return nil
+	}
+
+	u.hiResX += hiX
+	u.hiResY += hiY
+	detentsX := u.hiResX / wheelHiResUnit
+	detentsY := u.hiResY / wheelHiResUnit
+	u.hiResX -= detentsX * wheelHiResUnit
+	u.hiResY -= detentsY * wheelHiResUnit
+
+	var events []inputEvent
+	if hiY != 0 {
+		events = append(events, inputEvent{Type: evRel, Code: relWheelHiRes, Value: int32(hiY)})
+	}
+	if detentsY != 0 {
+		events = append(events, inputEvent{Type: evRel, Code: relWheel, Value: int32(detentsY)})
+	}
+	if hiX != 0 {
+		events = append(events, inputEvent{Type: evRel, Code: relHWheelHiRes, Value: int32(hiX)})
+	}
+	if detentsX != 0 {
+		events = append(events, inputEvent{Type: evRel, Code: relHWheel, Value: int32(detentsX)})
+	}
+	return u.write(u.pointer, events...)
+}
+
+// GetScreenSize returns the dimensions the virtual device was created with
+func (u *Uinput) GetScreenSize() (width, height int) {
+	return u.screenWidth, u.screenHeight
+}
+
+// Displays returns a single display covering the absolute axes. The kernel
+// knows nothing about the desktop layout, the compositor maps the axes
+// onto it.
+func (u *Uinput) Displays() []Rect {
+	return []Rect{{Width: u.screenWidth, Height: u.screenHeight}}
+}
+
+// GetMousePosition returns the current mouse cursor position as tracked
+// by the virtual device
+func (u *Uinput) GetMousePosition() (x, y int) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	return u.posX, u.posY
+}
+
+// KeyDown performs a key press
+func (u *Uinput) KeyDown(key Key) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	code, err := uinputKey(key)
+	if err != nil {
+		return err
+	}
+	return u.key(code, true)
+}
+
+// KeyUp performs a key release
+func (u *Uinput) KeyUp(key Key) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	code, err := uinputKey(key)
+	if err != nil {
+		return err
+	}
+	return u.key(code, false)
+}
+
+// TypeRune types a character. The kernel only knows key codes, so the
+// character is typed as it would be on a US keyboard layout.
+func (u *Uinput) TypeRune(r rune) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	key, shift, ok := usLayout(r)
+	if !ok {
+		return fmt.Errorf("cannot type %q: uinput only supports characters on the US keyboard layout", r)
+	}
+
+	if shift {
+		if err := u.key(keyLeftShift, true); err != nil {
+			return err
+		}
+		defer u.key(keyLeftShift, false)
+	}
+
+	code := uinputKeys[key]
+	if err := u.key(code, true); err != nil {
+		return err
+	}
+	return u.key(code, false)
+}
+
+// key presses or releases a key. Must be called with u.mu held.
+func (u *Uinput) key(code uint16, down bool) error {
+	value := int32(0)
+	if down {
+		value = 1
+	}
+	return u.write(u.keyboard, inputEvent{Type: evKey, Code: code, Value: value})
+}
+
+// Name returns "uinput"
+func (u *Uinput) Name() string {
+	return "uinput"
+}
+
+// Capabilities reports high-resolution scrolling and a US layout keyboard
+func (u *Uinput) Capabilities() Capabilities {
+	return Capabilities{
+		Keyboard:     true,
+		Scroll:       true,
+		SmoothScroll: true,
+		Buttons:      allButtons,
+	}
+}
+
+// Close destroys the virtual devices
+func (u *Uinput) Close() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	return errors.Join(destroyDevice(u.pointer), destroyDevice(u.keyboard))
+}
+
+// screenSize returns the dimensions of the first connected display,
+// as reported by the kernel's DRM subsystem
+func screenSize() (width, height int) {
+	connectors, _ := filepath.Glob("/sys/class/drm/card*-*")
+	for _, connector := range connectors {
+		status, err := os.ReadFile(filepath.Join(connector, "status"))
+		if err != nil || strings.TrimSpace(string(status)) != "connected" {
+			continue
+		}
+
+		// The first listed mode is the preferred one
+		modes, err := os.ReadFile(filepath.Join(connector, "modes"))
+		if err != nil {
+			continue
+		}
+		mode, _, _ := strings.Cut(string(modes), "\n")
+		w, h, ok := strings.Cut(mode, "x")
+		if !ok {
+			continue
+		}
+		width, errW := strconv.Atoi(w)
+		height, errH := strconv.Atoi(strings.TrimRightFunc(h, func(r rune) bool {
+			return r < '0' || r > '9'
+		}))
+		if errW == nil && errH == nil && width > 0 && height > 0 {
+			return width, height
+		}
+	}
+
+	return defaultScreenWidth, defaultScreenHeight
+}
@@ -4,21 +4,26 @@
 package native
 
 import (
+	"fmt"
 	"sync"
 	"syscall"
+	"unicode/utf16"
 	"unsafe"
 )
 
 var (
-	user32               = syscall.NewLazyDLL("user32.dll")
-	procGetSystemMetrics = user32.NewProc("GetSystemMetrics")
-	procSetCursorPos     = user32.NewProc("SetCursorPos")
-	procGetCursorPos     = user32.NewProc("GetCursorPos")
-	procMouseEvent       = user32.NewProc("mouse_event")
-	
-	mouseMutex sync.Mutex
+	user32                  = syscall.NewLazyDLL("user32.dll")
+	procGetSystemMetrics    = user32.NewProc("GetSystemMetrics")
+	procSetCursorPos        = user32.NewProc("SetCursorPos")
+	procGetCursorPos        = user32.NewProc("GetCursorPos")
+	procMouseEvent          = user32.NewProc("mouse_event")
+	procSendInput           = user32.NewProc("SendInput")
+	procEnumDisplayMonitors = user32.NewProc("EnumDisplayMonitors")
+	procGetMonitorInfo      = user32.NewProc("GetMonitorInfoW")
 )
 
+var platformBackends = []string{"windows"}
+
 const (
 	smCxScreen = 0
 	smCyScreen = 1
@@ -27,8 +32,169 @@ const (
 	mouseeventLeftup     = 0x0004
 	mouseeventRightdown  = 0x0008
 	mouseeventRightup    = 0x0010
+	mouseeventMiddledown = 0x0020
+	mouseeventMiddleup   = 0x0040
+	mouseeventXdown      = 0x0080
+	mouseeventXup        = 0x0100
 	mouseeventAbsolute   = 0x8000
 	mouseeventMove       = 0x0001
+	mouseeventWheel      = 0x0800
+	mouseeventHwheel     = 0x1000
+
+	// Side buttons share the X flags and are told apart by mouseData
+	xbutton1 = 0x0001
+	xbutton2 = 0x0002
+
+	// wheelDelta is one wheel detent, smaller amounts give smooth scrolling
+	wheelDelta = 120
+)
+
+const (
+	inputKeyboard = 1
+
+	keyeventfExtendedkey = 0x0001
+	keyeventfKeyup       = 0x0002
+	keyeventfUnicode     = 0x0004
+)
+
+// keybdInput mirrors the Win32 KEYBDINPUT structure
+type keybdInput struct {
+	Vk        uint16
+	Scan      uint16
+	Flags     uint32
+	Time      uint32
+	ExtraInfo uintptr
+}
+
+// keyboardInput mirrors an INPUT structure holding a KEYBDINPUT.
+// The padding covers the larger MOUSEINPUT member of the union.
+type keyboardInput struct {
+	Type uint32
+	Ki   keybdInput
+	_    [8]byte
+}
+
+// windowsKeys maps keys to their virtual-key codes
+var windowsKeys = map[Key]uint16{
+	KeyEnter:        0x0d,
+	KeyEscape:       0x1b,
+	KeyBackspace:    0x08,
+	KeyTab:          0x09,
+	KeySpace:        0x20,
+	KeyMinus:        0xbd,
+	KeyEqual:        0xbb,
+	KeyLeftBracket:  0xdb,
+	KeyRightBracket: 0xdd,
+	KeyBackslash:    0xdc,
+	KeySemicolon:    0xba,
+	KeyApostrophe:   0xde,
+	KeyGrave:        0xc0,
+	KeyComma:        0xbc,
+	KeyPeriod:       0xbe,
+	KeySlash:        0xbf,
+	KeyCapsLock:     0x14,
+
+	KeyInsert:   0x2d,
+	KeyDelete:   0x2e,
+	KeyHome:     0x24,
+	KeyEnd:      0x23,
+	KeyPageUp:   0x21,
+	KeyPageDown: 0x22,
+	KeyUp:       0x26,
+	KeyDown:     0x28,
+	KeyLeft:     0x25,
+	KeyRight:    0x27,
+
+	KeyShift: 0xa0,
+	KeyCtrl:  0xa2,
+	KeyAlt:   0xa4,
+	KeyMeta:  0x5b,
+
+	KeyPrintScreen: 0x2c,
+	KeyVolumeUp:    0xaf,
+	KeyVolumeDown:  0xae,
+	KeyMute:        0xad,
+	KeyPlayPause:   0xb3,
+	KeyNextTrack:   0xb0,
+	KeyPrevTrack:   0xb1,
+}
+
+// windowsExtendedKeys need KEYEVENTF_EXTENDEDKEY, otherwise Windows treats
+// them as their numeric keypad twins
+var windowsExtendedKeys = map[Key]bool{
+	KeyInsert: true, KeyDelete: true, KeyHome: true, KeyEnd: true,
+	KeyPageUp: true, KeyPageDown: true,
+	KeyUp: true, KeyDown: true, KeyLeft: true, KeyRight: true,
+	KeyMeta: true, KeyPrintScreen: true,
+}
+
+func init() {
+	for i := 0; i < 26; i++ {
+		windowsKeys[KeyA+Key(i)] = uint16('A' + i)
+	}
+	for i := 0; i < 10; i++ {
+		windowsKeys[Key0+Key(i)] = uint16('0' + i)
+	}
+	for i := 0; i < 12; i++ {
+		windowsKeys[KeyF1+Key(i)] = uint16(0x70 + i)
+	}
+}
+
+// windowsButtons maps buttons to their mouse_event flags
+var windowsButtons = map[Button]struct {
+	down, up, data uintptr
+}{
+	ButtonLeft:    {mouseeventLeftdown, mouseeventLeftup, 0},
+	ButtonRight:   {mouseeventRightdown, mouseeventRightup, 0},
+	ButtonMiddle:  {mouseeventMiddledown, mouseeventMiddleup, 0},
+	ButtonBack:    {mouseeventXdown, mouseeventXup, xbutton1},
+	ButtonForward: {mouseeventXdown, mouseeventXup, xbutton2},
+}
+
+// rect mirrors the Win32 RECT structure
+type rect struct {
+	Left   int32
+	Top    int32
+	Right  int32
+	Bottom int32
+}
+
+// monitorInfo mirrors the Win32 MONITORINFO structure
+type monitorInfo struct {
+	Size    uint32
+	Monitor rect
+	Work    rect
+	Flags   uint32
+}
+
+const monitorinfofPrimary = 0x1
+
+var (
+	// monitors collects the displays found by enumMonitorsCallback,
+	// monitorsMu serializes enumerations
+	monitors   []Rect
+	monitorsMu sync.Mutex
+
+	// enumMonitorsCallback is created once, Windows limits the number of callbacks
+	enumMonitorsCallback = syscall.NewCallback(func(monitor, hdc, clip, data uintptr) uintptr {
+		info := monitorInfo{Size: uint32(unsafe.Sizeof(monitorInfo{}))}
+		if r, _, _ := procGetMonitorInfo.Call(monitor, uintptr(unsafe.Pointer(&info))); r == 0 {
+			return 1
+		}
+		
+		display := Rect{
+			X:      int(info.Monitor.Left),
+			Y:      int(info.Monitor.Top),
+			Width:  int(info.Monitor.Right - info.Monitor.Left),
+			Height: int(info.Monitor.Bottom - info.Monitor.Top),
+		}
+		if info.Flags&monitorinfofPrimary != 0 {
+			monitors = append([]Rect{display}, monitors...)
+		} else {
+			monitors = append(monitors, display)
+		}
+		return 1
+	})
 )
 
 // POINT represents a point structure from Win32 API
@@ -37,18 +203,86 @@ type POINT struct {
 	Y int32
 }
 
+// Windows is a backend using the Win32 API
+type Windows struct {
+	// wheel carries amounts below the 1/120 detent resolution between calls
+	wheel wheelAccumulator
+
+	mu sync.Mutex
+}
+
+func init() {
+	Register("windows", func() (Backend, error) {
+		return NewWindows(), nil
+	})
+}
+
+// NewWindows creates a Win32 backend
+func NewWindows() *Windows {
+	return &Windows{}
+}
+
+// buttonEvent synthesizes a button event with the given flags
+func buttonEvent(flags, data uintptr) {
+	procMouseEvent.Call(flags, 0, 0, data, 0)
+}
+
+// wheelEvent synthesizes a wheel event scrolling by amount/wheelDelta detents
+func wheelEvent(flags uintptr, amount int) {
+	procMouseEvent.Call(flags, 0, 0, uintptr(uint32(int32(amount))), 0)
+}
+
+// sendInput injects keyboard input, returning the Win32 error if any
+// event was blocked
+func sendInput(inputs ...keyboardInput) error {
+	r, _, err := procSendInput.Call(
+		uintptr(len(inputs)),
+		uintptr(unsafe.Pointer(&inputs[0])),
+		unsafe.Sizeof(inputs[0]),
+	)
+	if int(r) != len(inputs) {
+		return fmt.Errorf("SendInput failed: %w", err)
+	}
+	return nil
+}
+
+// keyInput builds the input for pressing or releasing a key
+func keyInput(key Key, down bool) (keyboardInput, error) {
+	vk, ok := windowsKeys[key]
+	if !ok {
+		return keyboardInput{}, fmt.Errorf("unsupported key: %s", key)
+	}
+
+	input := keyboardInput{Type: inputKeyboard, Ki: keybdInput{Vk: vk}}
+	if windowsExtendedKeys[key] {
+		input.Ki.Flags |= keyeventfExtendedkey
+	}
+	if !down {
+		input.Ki.Flags |= keyeventfKeyup
+	}
+	return input, nil
+}
+
+// setCursorPos moves the cursor, returning the Win32 error on failure
+func setCursorPos(x, y int) error {
+	if r, _, err := procSetCursorPos.Call(uintptr(x), uintptr(y)); r == 0 {
+		return fmt.Errorf("SetCursorPos failed: %w", err)
+	}
+	return nil
+}
+
 // MoveAbsolute moves the mouse cursor to the specified absolute coordinates
-func MoveAbsolute(x, y int) {
-	mouseMutex.Lock()
-	defer mouseMutex.Unlock()
+func (w *Windows) MoveAbsolute(x, y int) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
 	
-	procSetCursorPos.Call(uintptr(x), uintptr(y))
+	return setCursorPos(x, y)
 }
 
 // MoveRelative moves the mouse cursor by the specified delta values
-func MoveRelative(deltaX, deltaY int) {
-	mouseMutex.Lock()
-	defer mouseMutex.Unlock()
+func (w *Windows) MoveRelative(deltaX, deltaY int) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
 	
 	var point POINT
 	procGetCursorPos.Call(uintptr(unsafe.Pointer(&point)))
@@ -56,153 +290,170 @@ func MoveRelative(deltaX, deltaY int) {
 	newX := int(point.X) + deltaX
 	newY := int(point.Y) + deltaY
 	
-	procSetCursorPos.Call(uintptr(newX), uintptr(newY))
+	return setCursorPos(newX, newY)
 }
 
-// LeftClick performs a left mouse button click
-func LeftClick() {
-	mouseMutex.Lock()
-	defer mouseMutex.Unlock()
+// ButtonDown performs a mouse button press
+func (w *Windows) ButtonDown(button Button) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
 	
-	procMouseEvent.Call(
-		uintptr(mouseeventLeftdown),
-		0,
-		0,
-		0,
-		0,
-	)
-	procMouseEvent.Call(
-		uintptr(mouseeventLeftup),
-		0,
-		0,
-		0,
-		0,
-	)
+	flags, ok := windowsButtons[button]
+	if !ok {
+		return fmt.Errorf("unsupported mouse button: %s", button)
+	}
+	buttonEvent(flags.down, flags.data)
+	return nil
 }
 
-// LeftDown performs a left mouse button press
-func LeftDown() {
-	mouseMutex.Lock()
-	defer mouseMutex.Unlock()
+// ButtonUp performs a mouse button release
+func (w *Windows) ButtonUp(button Button) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
 	
-	procMouseEvent.Call(
-		uintptr(mouseeventLeftdown),
-		0,
-		0,
-		0,
-		0,
-	)
+	flags, ok := windowsButtons[button]
+	if !ok {
+		return fmt.Errorf("unsupported mouse button: %s", button)
+	}
+	buttonEvent(flags.up, flags.data)
+	return nil
 }
 
-// LeftUp performs a left mouse button release
-func LeftUp() {
-	mouseMutex.Lock()
-	defer mouseMutex.Unlock()
+// Click performs a mouse button click
+func (w *Windows) Click(button Button) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
 	
-	procMouseEvent.Call(
-		uintptr(mouseeventLeftup),
-		0,
-		0,
-		0,
-		0,
-	)
+	flags, ok := windowsButtons[button]
+	if !ok {
+		return fmt.Errorf("unsupported mouse button: %s", button)
+	}
+	buttonEvent(flags.down, flags.data)
+	buttonEvent(flags.up, flags.data)
+	return nil
 }
 
-// RightClick performs a right mouse button click
-func RightClick() {
-	mouseMutex.Lock()
-	defer mouseMutex.Unlock()
+// DoubleClick performs a double click with the given button
+func (w *Windows) DoubleClick(button Button) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
 	
-	procMouseEvent.Call(
-		uintptr(mouseeventRightdown),
-		0,
-		0,
-		0,
-		0,
-	)
-	procMouseEvent.Call(
-		uintptr(mouseeventRightup),
-		0,
-		0,
-		0,
-		0,
-	)
+	flags, ok := windowsButtons[button]
+	if !ok {
+		return fmt.Errorf("unsupported mouse button: %s", button)
+	}
+	buttonEvent(flags.down, flags.data)
+	buttonEvent(flags.up, flags.data)
+	
+	buttonEvent(flags.down, flags.data)
+	buttonEvent(flags.up, flags.data)
+	return nil
 }
 
-// RightDown performs a right mouse button press
-func RightDown() {
-	mouseMutex.Lock()
-	defer mouseMutex.Unlock()
-	
-	procMouseEvent.Call(
-		uintptr(mouseeventRightdown),
-		0,
-		0,
-		0,
-		0,
-	)
+// Scroll scrolls by the given number of wheel detents
+func (w *Windows) Scroll(deltaX, deltaY float64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// Windows counts vertical wheel rotation away from the user as positive
+	amountX, amountY := w.wheel.steps(deltaX, -deltaY, wheelDelta)
+	if amountY != 0 {
+		wheelEvent(mouseeventWheel, amountY)
+	}
+	if amountX != 0 {
+		wheelEvent(mouseeventHwheel, amountX)
+	}
+	return nil
 }
 
-// RightUp performs a right mouse button release
-func RightUp() {
-	mouseMutex.Lock()
-	defer mouseMutex.Unlock()
-	
-	procMouseEvent.Call(
-		uintptr(mouseeventRightup),
-		0,
-		0,
-		0,
-		0,
-	)
+// GetScreenSize returns the primary display dimensions
+func (w *Windows) GetScreenSize() (width, height int) {
+	cx, _, _ := procGetSystemMetrics.Call(uintptr(smCxScreen))
+	cy, _, _ := procGetSystemMetrics.Call(uintptr(smCyScreen))
+	return int(cx), int(cy)
 }
 
-// DoubleClick performs a double click with the left mouse button
-func DoubleClick() {
-	mouseMutex.Lock()
-	defer mouseMutex.Unlock()
+// Displays returns every monitor of the virtual screen, primary first.
+// Monitors left of or above the primary one have negative coordinates.
+func (w *Windows) Displays() []Rect {
+	monitorsMu.Lock()
+	defer monitorsMu.Unlock()
 	
-	procMouseEvent.Call(
-		uintptr(mouseeventLeftdown),
-		0,
-		0,
-		0,
-		0,
-	)
-	procMouseEvent.Call(
-		uintptr(mouseeventLeftup),
-		0,
-		0,
-		0,
-		0,
-	)
+	monitors = nil
+	procEnumDisplayMonitors.Call(0, 0, enumMonitorsCallback, 0)
 	
-	procMouseEvent.Call(
-		uintptr(mouseeventLeftdown),
-		0,
-		0,
-		0,
-		0,
-	)
-	procMouseEvent.Call(
-		uintptr(mouseeventLeftup),
-		0,
-		0,
-		0,
-		0,
-	)
-}
-
-// GetScreenSize returns the primary display dimensions
-func GetScreenSize() (width, height int) {
-	w, _, _ := procGetSystemMetrics.Call(uintptr(smCxScreen))
-	h, _, _ := procGetSystemMetrics.Call(uintptr(smCyScreen))
-	return int(w), int(h)
+	if len(monitors) == 0 {
+		width, height := w.GetScreenSize()
+		return []Rect{{Width: width, Height: height}}
+	}
+	return append([]Rect(nil), monitors...)
 }
 
 // GetMousePosition returns the current mouse cursor position
-func GetMousePosition() (x, y int) {
+func (w *Windows) GetMousePosition() (x, y int) {
 	var point POINT
 	procGetCursorPos.Call(uintptr(unsafe.Pointer(&point)))
 	return int(point.X), int(point.Y)
-} 
\ No newline at end of file
+} 
+
+// KeyDown performs a key press
+func (w *Windows) KeyDown(key Key) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	
+	input, err := keyInput(key, true)
+	if err != nil {
+		return err
+	}
+	return sendInput(input)
+}
+
+// KeyUp performs a key release
+func (w *Windows) KeyUp(key Key) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	
+	input, err := keyInput(key, false)
+	if err != nil {
+		return err
+	}
+	return sendInput(input)
+}
+
+// TypeRune types any Unicode character, independent of the keyboard layout
+func (w *Windows) TypeRune(r rune) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	
+	// Characters outside the BMP are sent as a surrogate pair
+	var inputs []keyboardInput
+	for _, unit := range utf16.Encode([]rune{r}) {
+		inputs = append(inputs,
+			keyboardInput{Type: inputKeyboard, Ki: keybdInput{Scan: unit, Flags: keyeventfUnicode}},
+			keyboardInput{Type: inputKeyboard, Ki: keybdInput{Scan: unit, Flags: keyeventfUnicode | keyeventfKeyup}},
+		)
+	}
+	return sendInput(inputs...)
+}
+
+// Name returns "windows"
+func (w *Windows) Name() string {
+	return "windows"
+}
+
+// Capabilities reports full support, Windows accepts wheel amounts below a detent
+func (w *Windows) Capabilities() Capabilities {
+	return Capabilities{
+		Keyboard:     true,
+		Unicode:      true,
+		Scroll:       true,
+		SmoothScroll: true,
+		MultiMonitor: true,
+		Buttons:      allButtons,
+	}
+}
+
+// Close is a no-op, the Win32 API holds no per-backend resources
+func (w *Windows) Close() error {
+	return nil
+}
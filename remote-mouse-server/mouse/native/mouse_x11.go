@@ -0,0 +1,519 @@
+//go:build linux
+// +build linux
+
+package native
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/jezek/xgb"
+	"github.com/jezek/xgb/randr"
+	"github.com/jezek/xgb/xproto"
+	"github.com/jezek/xgb/xtest"
+)
+
+// X11 buttons as numbered by the core protocol
+const (
+	x11ButtonLeft       = 1
+	x11ButtonMiddle     = 2
+	x11ButtonRight      = 3
+	x11ButtonWheelUp    = 4
+	x11ButtonWheelDown  = 5
+	x11ButtonWheelLeft  = 6
+	x11ButtonWheelRight = 7
+	x11ButtonBack       = 8
+	x11ButtonForward    = 9
+)
+
+var x11Buttons = map[Button]byte{
+	ButtonLeft:    x11ButtonLeft,
+	ButtonRight:   x11ButtonRight,
+	ButtonMiddle:  x11ButtonMiddle,
+	ButtonBack:    x11ButtonBack,
+	ButtonForward: x11ButtonForward,
+}
+
+// x11Keysyms maps keys to the keysyms they produce without modifiers
+var x11Keysyms = map[Key]xproto.Keysym{
+	KeyF1: 0xffbe, KeyF2: 0xffbf, KeyF3: 0xffc0, KeyF4: 0xffc1,
+	KeyF5: 0xffc2, KeyF6: 0xffc3, KeyF7: 0xffc4, KeyF8: 0xffc5,
+	KeyF9: 0xffc6, KeyF10: 0xffc7, KeyF11: 0xffc8, KeyF12: 0xffc9,
+
+	KeyEnter:        0xff0d,
+	KeyEscape:       0xff1b,
+	KeyBackspace:    0xff08,
+	KeyTab:          0xff09,
+	KeySpace:        ' ',
+	KeyMinus:        '-',
+	KeyEqual:        '=',
+	KeyLeftBracket:  '[',
+	KeyRightBracket: ']',
+	KeyBackslash:    '\\',
+	KeySemicolon:    ';',
+	KeyApostrophe:   '\'',
+	KeyGrave:        '`',
+	KeyComma:        ',',
+	KeyPeriod:       '.',
+	KeySlash:        '/',
+	KeyCapsLock:     0xffe5,
+
+	KeyInsert:   0xff63,
+	KeyDelete:   0xffff,
+	KeyHome:     0xff50,
+	KeyEnd:      0xff57,
+	KeyPageUp:   0xff55,
+	KeyPageDown: 0xff56,
+	KeyUp:       0xff52,
+	KeyDown:     0xff54,
+	KeyLeft:     0xff51,
+	KeyRight:    0xff53,
+
+	KeyShift: 0xffe1,
+	KeyCtrl:  0xffe3,
+	KeyAlt:   0xffe9,
+	KeyMeta:  0xffeb,
+
+	KeyPrintScreen: 0xff61,
+	KeyVolumeUp:    0x1008ff13,
+	KeyVolumeDown:  0x1008ff11,
+	KeyMute:        0x1008ff12,
+	KeyPlayPause:   0x1008ff14,
+	KeyNextTrack:   0x1008ff17,
+	KeyPrevTrack:   0x1008ff16,
+}
+
+func init() {
+	for i := 0; i < 26; i++ {
+		x11Keysyms[KeyA+Key(i)] = xproto.Keysym('a' + i)
+	}
+	for i := 0; i < 10; i++ {
+		x11Keysyms[Key0+Key(i)] = xproto.Keysym('0' + i)
+	}
+}
+
+func x11Button(button Button) (byte, error) {
+	number, ok := x11Buttons[button]
+	if !ok {
+		return 0, fmt.Errorf("unsupported mouse button: %s", button)
+	}
+	return number, nil
+}
+
+// X11 is a backend injecting events into an X server through the XTEST
+// extension. Unlike uinput it needs no special permissions, only a
+// connection to the display (e.g. $DISPLAY pointing at Xorg or Xvfb).
+type X11 struct {
+	conn *xgb.Conn
+	root xproto.Window
+
+	screenWidth  int
+	screenHeight int
+	// randr is set when the RandR extension can describe the monitors
+	randr bool
+
+	// wheel carries partial detents between calls, as the core protocol
+	// can only scroll by whole button clicks
+	wheel wheelAccumulator
+
+	// The keyboard mapping, used to find the keycode producing a keysym
+	minKeycode        xproto.Keycode
+	keysymsPerKeycode int
+	keysyms           []xproto.Keysym
+	// scratchKeycode is an unused keycode that gets remapped to type
+	// characters missing from the keyboard layout, 0 if none is free
+	scratchKeycode xproto.Keycode
+
+	mu sync.Mutex
+}
+
+func init() {
+	Register("x11", func() (Backend, error) {
+		return NewX11("")
+	})
+}
+
+// NewX11 connects to the given X display.
+// An empty display uses the DISPLAY environment variable.
+func NewX11(display string) (*X11, error) {
+	conn, err := xgb.NewConnDisplay(display)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to X display: %w", err)
+	}
+
+	if err := xtest.Init(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("XTEST extension unavailable: %w", err)
+	}
+	if _, err := xtest.GetVersion(conn, 2, 2).Reply(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("querying XTEST version: %w", err)
+	}
+
+	setup := xproto.Setup(conn)
+	screen := setup.DefaultScreen(conn)
+
+	count := byte(setup.MaxKeycode - setup.MinKeycode + 1)
+	mapping, err := xproto.GetKeyboardMapping(conn, setup.MinKeycode, count).Reply()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("reading keyboard mapping: %w", err)
+	}
+
+	x := &X11{
+		conn:              conn,
+		root:              screen.Root,
+		screenWidth:       int(screen.WidthInPixels),
+		screenHeight:      int(screen.HeightInPixels),
+		minKeycode:        setup.MinKeycode,
+		keysymsPerKeycode: int(mapping.KeysymsPerKeycode),
+		keysyms:           mapping.Keysyms,
+	}
+	x.scratchKeycode = x.findScratchKeycode()
+	x.randr = randr.Init(conn) == nil
+	return x, nil
+}
+
+// fakeInput sends a single XTEST event and waits for the server to accept it.
+// Must be called with x.mu held.
+func (x *X11) fakeInput(eventType, detail byte, rootX, rootY int) error {
+	err := xtest.FakeInputChecked(x.conn, eventType, detail, 0, x.root,
+		int16(rootX), int16(rootY), 0).Check()
+	if err != nil {
+		return fmt.Errorf("XTEST fake input failed: %w", err)
+	}
+	return nil
+}
+
+// button presses or releases a button. Must be called with x.mu held.
+func (x *X11) button(button byte, down bool) error {
+	eventType := byte(xproto.ButtonRelease)
+	if down {
+		eventType = xproto.ButtonPress
+	}
+	return x.fakeInput(eventType, button, 0, 0)
+}
+
+// click presses and releases a button. Must be called with x.mu held.
+func (x *X11) click(button byte) error {
+	if err := x.button(button, true); err != nil {
+		return err
+	}
+	return x.button(button, false)
+}
+
+// MoveAbsolute moves the mouse cursor to the specified absolute coordinates
+func (x *X11) MoveAbsolute(posX, posY int) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	return x.fakeInput(xproto.MotionNotify, 0, posX, posY)
+}
+
+// MoveRelative moves the mouse cursor by the specified delta values
+func (x *X11) MoveRelative(deltaX, deltaY int) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	// A non-zero detail makes the motion relative to the current position
+	return x.fakeInput(xproto.MotionNotify, 1, deltaX, deltaY)
+}
+
+// ButtonDown performs a mouse button press
+func (x *X11) ButtonDown(button Button) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	number, err := x11Button(button)
+	if err != nil {
+		return err
+	}
+	return x.button(number, true)
+}
+
+// ButtonUp performs a mouse button release
+func (x *X11) ButtonUp(button Button) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	number, err := x11Button(button)
+	if err != nil {
+		return err
+	}
+	return x.button(number, false)
+}
+
+// Click performs a mouse button click
+func (x *X11) Click(button Button) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	number, err := x11Button(button)
+	if err != nil {
+		return err
+	}
+	return x.click(number)
+}
+
+// DoubleClick performs a double click with the given button
+func (x *X11) DoubleClick(button Button) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	number, err := x11Button(button)
+	if err != nil {
+		return err
+	}
+	if err := x.click(number); err != nil {
+		return err
+	}
+	return x.click(number)
+}
+
+// Scroll scrolls by the given number of wheel detents, sending one wheel
+// button click per whole detent
+func (x *X11) Scroll(deltaX, deltaY float64) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	stepsX, stepsY := x.wheel.steps(deltaX, deltaY, 1)
+
+	scroll := func(steps int, negative, positive byte) error {
+		button := positive
+		if steps < 0 {
+			button, steps = negative, -steps
+		}
+		for i := 0; i < steps; i++ {
+			if err := x.click(button); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := scroll(stepsY, x11ButtonWheelUp, x11ButtonWheelDown); err != nil {
+		return err
+	}
+	return scroll(stepsX, x11ButtonWheelLeft, x11ButtonWheelRight)
+}
+
+// GetScreenSize returns the size of the default screen's root window
+func (x *X11) GetScreenSize() (width, height int) {
+	return x.screenWidth, x.screenHeight
+}
+
+// Displays returns the monitors driven by RandR, primary first.
+// Without RandR the whole root window is reported as one display.
+func (x *X11) Displays() []Rect {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	root := []Rect{{Width: x.screenWidth, Height: x.screenHeight}}
+	if !x.randr {
+		return root
+	}
+
+	resources, err := randr.GetScreenResourcesCurrent(x.conn, x.root).Reply()
+	if err != nil {
+		return root
+	}
+	var primary randr.Output
+	if reply, err := randr.GetOutputPrimary(x.conn, x.root).Reply(); err == nil {
+		primary = reply.Output
+	}
+
+	var displays []Rect
+	for _, crtc := range resources.Crtcs {
+		info, err := randr.GetCrtcInfo(x.conn, crtc, resources.ConfigTimestamp).Reply()
+		// Disabled CRTCs have no mode
+		if err != nil || info.Mode == 0 || info.Width == 0 || info.Height == 0 {
+			continue
+		}
+
+		display := Rect{X: int(info.X), Y: int(info.Y), Width: int(info.Width), Height: int(info.Height)}
+		isPrimary := false
+		for _, output := range info.Outputs {
+			isPrimary = isPrimary || (primary != 0 && output == primary)
+		}
+		if isPrimary {
+			displays = append([]Rect{display}, displays...)
+		} else {
+			displays = append(displays, display)
+		}
+	}
+
+	if len(displays) == 0 {
+		return root
+	}
+	return displays
+}
+
+// GetMousePosition returns the current pointer position on the root window
+func (x *X11) GetMousePosition() (posX, posY int) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	reply, err := xproto.QueryPointer(x.conn, x.root).Reply()
+	if err != nil {
+		return 0, 0
+	}
+	return int(reply.RootX), int(reply.RootY)
+}
+
+// KeyDown performs a key press
+func (x *X11) KeyDown(key Key) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	keycode, err := x.keycode(key)
+	if err != nil {
+		return err
+	}
+	return x.fakeInput(xproto.KeyPress, byte(keycode), 0, 0)
+}
+
+// KeyUp performs a key release
+func (x *X11) KeyUp(key Key) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	keycode, err := x.keycode(key)
+	if err != nil {
+		return err
+	}
+	return x.fakeInput(xproto.KeyRelease, byte(keycode), 0, 0)
+}
+
+// TypeRune types a character through the keysym producing it. Characters
+// missing from the keyboard layout are typed by temporarily mapping them
+// to an unused keycode.
+func (x *X11) TypeRune(r rune) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	keysym := runeKeysym(r)
+	keycode, shift, ok := x.lookup(keysym)
+	if !ok {
+		if x.scratchKeycode == 0 {
+			return fmt.Errorf("cannot type %q: no free keycode to map it to", r)
+		}
+		if err := x.remap(x.scratchKeycode, keysym); err != nil {
+			return err
+		}
+		keycode, shift = x.scratchKeycode, false
+	}
+
+	if shift {
+		shiftKeycode, _, ok := x.lookup(x11Keysyms[KeyShift])
+		if ok {
+			if err := x.fakeInput(xproto.KeyPress, byte(shiftKeycode), 0, 0); err != nil {
+				return err
+			}
+			defer x.fakeInput(xproto.KeyRelease, byte(shiftKeycode), 0, 0)
+		}
+	}
+
+	if err := x.fakeInput(xproto.KeyPress, byte(keycode), 0, 0); err != nil {
+		return err
+	}
+	return x.fakeInput(xproto.KeyRelease, byte(keycode), 0, 0)
+}
+
+// keycode returns the keycode that produces key. Must be called with x.mu held.
+func (x *X11) keycode(key Key) (xproto.Keycode, error) {
+	keysym, ok := x11Keysyms[key]
+	if !ok {
+		return 0, fmt.Errorf("unsupported key: %s", key)
+	}
+	keycode, _, ok := x.lookup(keysym)
+	if !ok {
+		return 0, fmt.Errorf("key %s is not on the X keyboard layout", key)
+	}
+	return keycode, nil
+}
+
+// lookup finds the keycode producing keysym, either directly or with shift.
+// Must be called with x.mu held.
+func (x *X11) lookup(keysym xproto.Keysym) (keycode xproto.Keycode, shift bool, ok bool) {
+	for column := 0; column < 2 && column < x.keysymsPerKeycode; column++ {
+		for i := column; i < len(x.keysyms); i += x.keysymsPerKeycode {
+			if x.keysyms[i] == keysym {
+				return x.minKeycode + xproto.Keycode(i/x.keysymsPerKeycode), column == 1, true
+			}
+		}
+	}
+	return 0, false, false
+}
+
+// findScratchKeycode returns the highest keycode without any keysyms
+func (x *X11) findScratchKeycode() xproto.Keycode {
+	for i := len(x.keysyms)/x.keysymsPerKeycode - 1; i >= 0; i-- {
+		empty := true
+		for _, keysym := range x.keysyms[i*x.keysymsPerKeycode : (i+1)*x.keysymsPerKeycode] {
+			if keysym != 0 {
+				empty = false
+				break
+			}
+		}
+		if empty {
+			return x.minKeycode + xproto.Keycode(i)
+		}
+	}
+	return 0
+}
+
+// remap points keycode at keysym. Must be called with x.mu held.
+func (x *X11) remap(keycode xproto.Keycode, keysym xproto.Keysym) error {
+	syms := make([]xproto.Keysym, x.keysymsPerKeycode)
+	for i := range syms {
+		syms[i] = keysym
+	}
+
+	err := xproto.ChangeKeyboardMappingChecked(x.conn, 1, keycode, byte(x.keysymsPerKeycode), syms).Check()
+	if err != nil {
+		return fmt.Errorf("remapping keycode %d: %w", keycode, err)
+	}
+
+	offset := int(keycode-x.minKeycode) * x.keysymsPerKeycode
+	copy(x.keysyms[offset:offset+x.keysymsPerKeycode], syms)
+	return nil
+}
+
+// runeKeysym returns the keysym for a character. Latin-1 characters have
+// keysyms equal to their code point, everything else uses the Unicode range.
+func runeKeysym(r rune) xproto.Keysym {
+	switch r {
+	case '\n':
+		return x11Keysyms[KeyEnter]
+	case '\t':
+		return x11Keysyms[KeyTab]
+	}
+	if (r >= 0x20 && r <= 0x7e) || (r >= 0xa0 && r <= 0xff) {
+		return xproto.Keysym(r)
+	}
+	return xproto.Keysym(0x01000000 | r)
+}
+
+// Name returns "x11"
+func (x *X11) Name() string {
+	return "x11"
+}
+
+// Capabilities reports Unicode typing when a spare keycode can be remapped,
+// and the monitor layout when RandR is available. The core protocol only
+// scrolls by whole detents.
+func (x *X11) Capabilities() Capabilities {
+	return Capabilities{
+		Keyboard:     true,
+		Unicode:      x.scratchKeycode != 0,
+		Scroll:       true,
+		MultiMonitor: x.randr,
+		Buttons:      allButtons,
+	}
+}
+
+// Close disconnects from the X server
+func (x *X11) Close() error {
+	x.conn.Close()
+	return nil
+}
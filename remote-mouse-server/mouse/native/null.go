@@ -0,0 +1,35 @@
+package native
+
+// Null is a backend that discards every event.
+// Useful when running the server without access to an input device.
+type Null struct{}
+
+func init() {
+	Register("null", func() (Backend, error) {
+		return NewNull(), nil
+	})
+}
+
+// NewNull creates a backend that does nothing
+func NewNull() *Null {
+	return &Null{}
+}
+
+func (n *Null) MoveAbsolute(x, y int) error           { return nil }
+func (n *Null) MoveRelative(deltaX, deltaY int) error { return nil }
+func (n *Null) ButtonDown(button Button) error        { return nil }
+func (n *Null) ButtonUp(button Button) error          { return nil }
+func (n *Null) Click(button Button) error             { return nil }
+func (n *Null) DoubleClick(button Button) error       { return nil }
+func (n *Null) Scroll(deltaX, deltaY float64) error   { return nil }
+func (n *Null) GetScreenSize() (width, height int)    { return 0, 0 }
+func (n *Null) Displays() []Rect                      { return nil }
+func (n *Null) GetMousePosition() (x, y int)          { return 0, 0 }
+func (n *Null) KeyDown(key Key) error                 { return nil }
+func (n *Null) KeyUp(key Key) error                   { return nil }
+func (n *Null) TypeRune(r rune) error                 { return nil }
+func (n *Null) Name() string                          { return "null" }
+func (n *Null) Close() error                          { return nil }
+
+// Capabilities reports nothing, as every event is dropped
+func (n *Null) Capabilities() Capabilities { return Capabilities{} }
@@ -0,0 +1,21 @@
+package native
+
+// wheelAccumulator turns fractional scroll deltas into the whole steps a
+// platform can inject, carrying the remainder over to the next call so
+// slow, smooth scrolling isn't lost.
+type wheelAccumulator struct {
+	x float64
+	y float64
+}
+
+// steps adds deltaX, deltaY (in wheel detents) and returns how many whole
+// steps of 1/resolution detent are ready on each axis
+func (a *wheelAccumulator) steps(deltaX, deltaY, resolution float64) (x, y int) {
+	a.x += deltaX * resolution
+	a.y += deltaY * resolution
+
+	x, y = int(a.x), int(a.y)
+	a.x -= float64(x)
+	a.y -= float64(y)
+	return x, y
+}
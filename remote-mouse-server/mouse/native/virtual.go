@@ -0,0 +1,310 @@
+package native
+
+import (
+	"fmt"
+	"sync"
+)
+
+// EventKind identifies an event recorded by the virtual backend
+type EventKind string
+
+const (
+	EventMove       EventKind = "move"
+	EventButtonDown EventKind = "down"
+	EventButtonUp   EventKind = "up"
+	EventScroll     EventKind = "scroll"
+	EventKeyDown    EventKind = "keydown"
+	EventKeyUp      EventKind = "keyup"
+	EventType       EventKind = "type"
+)
+
+// Event is a single entry in the virtual backend's event log
+type Event struct {
+	Kind EventKind
+	// X and Y hold the cursor position after the event
+	X int
+	Y int
+	// Button is set for button events
+	Button Button
+	// ScrollX and ScrollY are set for scroll events, in wheel detents
+	ScrollX float64
+	ScrollY float64
+	// Key is set for key events
+	Key Key
+	// Rune is set for type events
+	Rune rune
+}
+
+func (e Event) String() string {
+	switch e.Kind {
+	case EventMove:
+		return fmt.Sprintf("%s %d,%d", e.Kind, e.X, e.Y)
+	case EventScroll:
+		return fmt.Sprintf("%s %g,%g", e.Kind, e.ScrollX, e.ScrollY)
+	case EventKeyDown, EventKeyUp:
+		return fmt.Sprintf("%s %s", e.Kind, e.Key)
+	case EventType:
+		return fmt.Sprintf("%s %q", e.Kind, e.Rune)
+	}
+	return fmt.Sprintf("%s %s", e.Kind, e.Button)
+}
+
+// Virtual is an in-memory backend simulating a desktop and a mouse.
+// It never touches the OS cursor, which makes it suitable for headless
+// testing: every event is recorded in order and can be inspected with Events.
+type Virtual struct {
+	// displays holds the simulated monitors, primary first
+	displays []Rect
+	x        int
+	y        int
+	buttons  map[Button]bool
+	scrollX  float64
+	scrollY  float64
+	keys     map[Key]bool
+	text     []rune
+	events   []Event
+
+	mu sync.Mutex
+}
+
+func init() {
+	Register("virtual", func() (Backend, error) {
+		return NewVirtual(defaultVirtualWidth, defaultVirtualHeight), nil
+	})
+}
+
+const (
+	defaultVirtualWidth  = 1920
+	defaultVirtualHeight = 1080
+)
+
+// NewVirtual creates a virtual screen of the given size with the cursor
+// at its centre
+func NewVirtual(width, height int) *Virtual {
+	return NewVirtualDesktop(Rect{Width: width, Height: height})
+}
+
+// NewVirtualDesktop creates a virtual desktop made of several displays,
+// the first being the primary one. The cursor starts at its centre.
+func NewVirtualDesktop(displays ...Rect) *Virtual {
+	if len(displays) == 0 {
+		displays = []Rect{{Width: defaultVirtualWidth, Height: defaultVirtualHeight}}
+	}
+
+	primary := displays[0]
+	return &Virtual{
+		displays: append([]Rect(nil), displays...),
+		x:        primary.X + primary.Width/2,
+		y:        primary.Y + primary.Height/2,
+		buttons:  make(map[Button]bool),
+		keys:     make(map[Key]bool),
+	}
+}
+
+// moveTo clamps x,y to the displays, like an OS cursor would, and records
+// the move. Must be called with v.mu held.
+func (v *Virtual) moveTo(x, y int) {
+	x, y = ClampToDisplays(v.displays, x, y)
+
+	v.x, v.y = x, y
+	v.events = append(v.events, Event{Kind: EventMove, X: x, Y: y})
+}
+
+// button updates a button state and records it. Must be called with v.mu held.
+func (v *Virtual) button(button Button, down bool) {
+	kind := EventButtonUp
+	if down {
+		kind = EventButtonDown
+	}
+
+	v.buttons[button] = down
+	v.events = append(v.events, Event{Kind: kind, X: v.x, Y: v.y, Button: button})
+}
+
+func (v *Virtual) MoveAbsolute(x, y int) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.moveTo(x, y)
+	return nil
+}
+
+func (v *Virtual) MoveRelative(deltaX, deltaY int) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.moveTo(v.x+deltaX, v.y+deltaY)
+	return nil
+}
+
+func (v *Virtual) ButtonDown(button Button) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.button(button, true)
+	return nil
+}
+
+func (v *Virtual) ButtonUp(button Button) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.button(button, false)
+	return nil
+}
+
+func (v *Virtual) Click(button Button) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.button(button, true)
+	v.button(button, false)
+	return nil
+}
+
+func (v *Virtual) DoubleClick(button Button) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	for i := 0; i < 2; i++ {
+		v.button(button, true)
+		v.button(button, false)
+	}
+	return nil
+}
+
+func (v *Virtual) Scroll(deltaX, deltaY float64) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.scrollX += deltaX
+	v.scrollY += deltaY
+	v.events = append(v.events, Event{Kind: EventScroll, X: v.x, Y: v.y, ScrollX: deltaX, ScrollY: deltaY})
+	return nil
+}
+
+func (v *Virtual) KeyDown(key Key) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.keys[key] = true
+	v.events = append(v.events, Event{Kind: EventKeyDown, X: v.x, Y: v.y, Key: key})
+	return nil
+}
+
+func (v *Virtual) KeyUp(key Key) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.keys[key] = false
+	v.events = append(v.events, Event{Kind: EventKeyUp, X: v.x, Y: v.y, Key: key})
+	return nil
+}
+
+func (v *Virtual) TypeRune(r rune) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.text = append(v.text, r)
+	v.events = append(v.events, Event{Kind: EventType, X: v.x, Y: v.y, Rune: r})
+	return nil
+}
+
+func (v *Virtual) GetScreenSize() (width, height int) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	return v.displays[0].Width, v.displays[0].Height
+}
+
+func (v *Virtual) Displays() []Rect {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	return append([]Rect(nil), v.displays...)
+}
+
+func (v *Virtual) GetMousePosition() (x, y int) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	return v.x, v.y
+}
+
+func (v *Virtual) Name() string {
+	return "virtual"
+}
+
+func (v *Virtual) Capabilities() Capabilities {
+	return Capabilities{
+		Keyboard:     true,
+		Unicode:      true,
+		Scroll:       true,
+		SmoothScroll: true,
+		MultiMonitor: true,
+		Buttons:      allButtons,
+	}
+}
+
+func (v *Virtual) Close() error {
+	return nil
+}
+
+// SetMousePosition places the cursor without recording an event,
+// for setting up a known starting state
+func (v *Virtual) SetMousePosition(x, y int) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.x, v.y = x, y
+}
+
+// IsPressed reports whether the button is currently held down
+func (v *Virtual) IsPressed(button Button) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	return v.buttons[button]
+}
+
+// IsKeyPressed reports whether the key is currently held down
+func (v *Virtual) IsKeyPressed(key Key) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	return v.keys[key]
+}
+
+// Text returns every character typed with TypeRune so far
+func (v *Virtual) Text() string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	return string(v.text)
+}
+
+// ScrollOffset returns the total distance scrolled on each axis, in wheel detents
+func (v *Virtual) ScrollOffset() (x, y float64) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	return v.scrollX, v.scrollY
+}
+
+// Events returns a copy of the event log in the order events happened
+func (v *Virtual) Events() []Event {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	events := make([]Event, len(v.events))
+	copy(events, v.events)
+	return events
+}
+
+// ClearEvents empties the event log, keeping cursor and button state
+func (v *Virtual) ClearEvents() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.events = nil
+}
@@ -1,29 +1,58 @@
 package mouse
 
 import (
+	"fmt"
 	"math"
 	"time"
 )
 
+// StabilizationOptions are the stabilization settings. The controller
+// keeps its own copy, so options passed to it can be reused freely.
 type StabilizationOptions struct {
-	DeadZone       int     // Ignore movements smaller than this value (in pixels)
+	DeadZone       int     // Ignore movements adding up to less than this value (in pixels) within 100ms
 	SmoothingLevel float64 // 0.0-1.0: higher values mean more smoothing
 	JiggleFilter   bool    // Enable anti-jiggle filtering
 	AntiDrift      bool    // Enable anti-drift compensation
-	
-	lastX          int
-	lastY          int
+}
+
+// Validate checks the option values
+func (o *StabilizationOptions) Validate() error {
+	if o.DeadZone < 0 {
+		return fmt.Errorf("dead zone must not be negative, got %d", o.DeadZone)
+	}
+	if math.IsNaN(o.SmoothingLevel) || o.SmoothingLevel < 0 || o.SmoothingLevel > 1 {
+		return fmt.Errorf("smoothing must be between 0 and 1, got %g", o.SmoothingLevel)
+	}
+	return nil
+}
+
+// historySize is the number of movements the jiggle filter looks at
+const historySize = 5
+
+// deadZoneWindow is how long movements add up before the dead zone drops them
+const deadZoneWindow = 100 * time.Millisecond
+
+// Stabilizer is the filter state of one input stream, e.g. one phone.
+// It isn't safe for concurrent use, the controller serializes the moves
+// using it.
+type Stabilizer struct {
+	lastX          float64
+	lastY          float64
 	lastMoveTime   time.Time
 	velocityX      float64
 	velocityY      float64
-	histories      []PositionHistory
+	histories      [historySize]PositionHistory
 	historyPointer int
-	historySize    int
+	// pendingX and pendingY add up the motion inside the dead zone since
+	// pendingSince
+	pendingX       float64
+	pendingY       float64
+	pendingSince   time.Time
 }
 
 type PositionHistory struct {
-	X          int
-	Y          int
+	X          float64
+	Y          float64
 	Time       time.Time
 	VelocityX  float64
 	VelocityY  float64
@@ -35,89 +64,102 @@ func DefaultStabilizationOptions() *StabilizationOptions {
 		SmoothingLevel: 0.3,
 		JiggleFilter:   true,
 		AntiDrift:      true,
-		historySize:    5,
-		histories:      make([]PositionHistory, 5),
-		lastMoveTime:   time.Now(),
 	}
 }
 
-func (s *StabilizationOptions) ProcessMovement(deltaX, deltaY int) (int, int, bool) {
+// NewStabilizer creates the filter state of a new input stream
+func NewStabilizer() *Stabilizer {
+	return &Stabilizer{lastMoveTime: time.Now()}
+}
+
+// ProcessMovement filters a movement delta with the given options.
+// Fractions are kept so the controller can accumulate sub-pixel motion.
+func (s *Stabilizer) ProcessMovement(options *StabilizationOptions, deltaX, deltaY float64) (float64, float64, bool) {
 	now := time.Now()
 	
-	if s.DeadZone > 0 {
-		if math.Abs(float64(deltaX)) < float64(s.DeadZone) {
-			deltaX = 0
+	// The dead zone applies to the motion of the last deadZoneWindow, so
+	// slow deliberate movement adds up past it while drift doesn't
+	if options.DeadZone > 0 {
+		if now.Sub(s.pendingSince) > deadZoneWindow {
+			s.pendingX, s.pendingY = 0, 0
+			s.pendingSince = now
 		}
-		if math.Abs(float64(deltaY)) < float64(s.DeadZone) {
-			deltaY = 0
+		s.pendingX += deltaX
+		s.pendingY += deltaY
+		
+		if math.Abs(s.pendingX) < float64(options.DeadZone) && math.Abs(s.pendingY) < float64(options.DeadZone) {
+			return 0, 0, false
 		}
+		deltaX, deltaY = s.pendingX, s.pendingY
+		s.pendingX, s.pendingY = 0, 0
+		s.pendingSince = now
 	}
 	
-	// If no movement after dead zone, nothing to do
+	// If no movement, nothing to do
 	if deltaX == 0 && deltaY == 0 {
 		return 0, 0, false
 	}
 	
 	// Apply anti-jiggle filtering
-	if s.JiggleFilter {
+	if options.JiggleFilter {
 		timeElapsed := now.Sub(s.lastMoveTime).Seconds()
 		
 		s.histories[s.historyPointer] = PositionHistory{
 			X:         deltaX,
 			Y:         deltaY,
 			Time:      now,
-			VelocityX: float64(deltaX) / timeElapsed,
-			VelocityY: float64(deltaY) / timeElapsed,
+			VelocityX: deltaX / timeElapsed,
+			VelocityY: deltaY / timeElapsed,
 		}
 		
-		s.historyPointer = (s.historyPointer + 1) % s.historySize
+		s.historyPointer = (s.historyPointer + 1) % historySize
 		
-		sumX, sumY := 0, 0
+		sumX, sumY := 0.0, 0.0
 
-		for i := 0; i < s.historySize; i++ {
+		for i := 0; i < historySize; i++ {
 			sumX += s.histories[i].X
 			sumY += s.histories[i].Y
 		}
 		
 
-		absSum := math.Abs(float64(sumX)) + math.Abs(float64(sumY))
+		absSum := math.Abs(sumX) + math.Abs(sumY)
 		absTotal := 0.0
 
-		for i := 0; i < s.historySize; i++ {
-			absTotal += math.Abs(float64(s.histories[i].X))
-			absTotal += math.Abs(float64(s.histories[i].Y))
+		for i := 0; i < historySize; i++ {
+			absTotal += math.Abs(s.histories[i].X)
+			absTotal += math.Abs(s.histories[i].Y)
 		}
 		
 		// If we have high movement but low net movement, it's likely jiggle
-		if absTotal > 0 && absSum/absTotal < 0.3 && absTotal > float64(s.DeadZone*s.historySize) {
-			if math.Abs(float64(sumX)) > math.Abs(float64(sumY)) {
+		if absTotal > 0 && absSum/absTotal < 0.3 && absTotal > float64(options.DeadZone*historySize) {
+			if math.Abs(sumX) > math.Abs(sumY) {
 				deltaY = 0
-				deltaX = int(float64(sumX) / float64(s.historySize))
+				deltaX = sumX / float64(historySize)
 			} else {
 				deltaX = 0
-				deltaY = int(float64(sumY) / float64(s.historySize))
+				deltaY = sumY / float64(historySize)
 			}
 		}
 	}
 	
 	// Apply smoothing (if needed)
-	if s.SmoothingLevel > 0 {
+	if options.SmoothingLevel > 0 {
 
 		timeDelta := now.Sub(s.lastMoveTime).Seconds()
 
 		if timeDelta > 0 {
-			currentVelocityX := float64(deltaX) / timeDelta
-			currentVelocityY := float64(deltaY) / timeDelta
+			currentVelocityX := deltaX / timeDelta
+			currentVelocityY := deltaY / timeDelta
 			
-			s.velocityX = s.velocityX*(s.SmoothingLevel) + currentVelocityX*(1-s.SmoothingLevel)
-			s.velocityY = s.velocityY*(s.SmoothingLevel) + currentVelocityY*(1-s.SmoothingLevel)
+			s.velocityX = s.velocityX*(options.SmoothingLevel) + currentVelocityX*(1-options.SmoothingLevel)
+			s.velocityY = s.velocityY*(options.SmoothingLevel) + currentVelocityY*(1-options.SmoothingLevel)
 			
-			deltaX = int(s.velocityX * timeDelta)
-			deltaY = int(s.velocityY * timeDelta)
+			deltaX = s.velocityX * timeDelta
+			deltaY = s.velocityY * timeDelta
 		}
 	}
 	
-	if s.AntiDrift {
+	if options.AntiDrift {
 		timeSinceLastMove := now.Sub(s.lastMoveTime).Milliseconds()
 
 		if timeSinceLastMove > 2000 {  // 2 seconds threshold
@@ -125,8 +167,8 @@ func (s *StabilizationOptions) ProcessMovement(deltaX, deltaY int) (int, int, bo
 			s.velocityX = 0
 			s.velocityY = 0
 			
-			if math.Abs(float64(deltaX)) <= float64(s.DeadZone*2) && 
-			   math.Abs(float64(deltaY)) <= float64(s.DeadZone*2) {
+			if math.Abs(deltaX) <= float64(options.DeadZone*2) && 
+			   math.Abs(deltaY) <= float64(options.DeadZone*2) {
 				return 0, 0, false
 			}
 		}
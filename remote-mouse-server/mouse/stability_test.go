@@ -0,0 +1,43 @@
+package mouse
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tommyalmeida/remote-mouse/mouse/native"
+)
+
+func TestDeadZone(t *testing.T) {
+	tests := []struct {
+		name  string
+		delta float64
+		pause time.Duration
+		moves int
+		want  int
+	}{
+		{name: "slow movement adds up", delta: 0.5, moves: 8, want: 4},
+		{name: "fast movement passes", delta: 3, moves: 2, want: 6},
+		{name: "drift is dropped", delta: 0.2, pause: 30 * time.Millisecond, moves: 8, want: 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			virtual := native.NewVirtual(1920, 1080)
+			config := DefaultConfig()
+			config.Silent = true
+			config.Stabilization = &StabilizationOptions{DeadZone: 2}
+			controller := NewController(config, virtual)
+
+			for i := 0; i < test.moves; i++ {
+				if err := controller.Move(test.delta, 0); err != nil {
+					t.Fatal(err)
+				}
+				time.Sleep(test.pause)
+			}
+
+			if x, _ := virtual.GetMousePosition(); x-960 != test.want {
+				t.Errorf("moved %d pixels, want %d", x-960, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// networkAliases name common ranges for allowlists
+var networkAliases = map[string][]string{
+	"loopback":  {"127.0.0.0/8", "::1/128"},
+	"private":   {"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7", "169.254.0.0/16", "fe80::/10"},
+	"tailscale": {"100.64.0.0/10", "fd7a:115c:a1e0::/48"},
+}
+
+// Allowlist restricts where connections may come from. The zero value
+// accepts every address, and only origins of the server itself.
+type Allowlist struct {
+	// Origins are the allowed values of the Origin header, like
+	// "https://example.com", "*" allows every origin. Requests without an
+	// Origin, which come from native apps, and pages served by this server
+	// under localhost, the machine's name or one of its addresses are
+	// always allowed.
+	Origins []string
+	// Networks are the allowed source address ranges, empty allows every
+	// address
+	Networks []netip.Prefix
+}
+
+// ParseNetworks parses a comma separated list of CIDR ranges, single
+// addresses and the aliases "loopback", "private" and "tailscale"
+func ParseNetworks(list string) ([]netip.Prefix, error) {
+	var networks []netip.Prefix
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if alias, ok := networkAliases[strings.ToLower(entry)]; ok {
+			for _, cidr := range alias {
+				networks = append(networks, netip.MustParsePrefix(cidr))
+			}
+			continue
+		}
+		if strings.Contains(entry, "/") {
+			network, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid network %q: %w", entry, err)
+			}
+			networks = append(networks, network.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q, expected a CIDR range, an address or one of loopback, private, tailscale", entry)
+		}
+		networks = append(networks, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+	return networks, nil
+}
+
+// ParseOrigins parses a comma separated list of origins
+func ParseOrigins(list string) []string {
+	var origins []string
+	for _, origin := range strings.Split(list, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, strings.TrimSuffix(origin, "/"))
+		}
+	}
+	return origins
+}
+
+// check rejects requests from a network or origin that isn't allowed
+func (a *Allowlist) check(r *http.Request) error {
+	if err := a.checkAddress(r.RemoteAddr); err != nil {
+		return err
+	}
+	return a.checkOrigin(r)
+}
+
+// checkAddress rejects addresses outside the allowed networks
+func (a *Allowlist) checkAddress(remoteAddr string) error {
+	if len(a.Networks) == 0 {
+		return nil
+	}
+
+	addrPort, err := netip.ParseAddrPort(remoteAddr)
+	if err != nil {
+		return fmt.Errorf("invalid remote address %q", remoteAddr)
+	}
+	addr := addrPort.Addr().Unmap()
+	for _, network := range a.Networks {
+		if network.Contains(addr) {
+			return nil
+		}
+	}
+	return fmt.Errorf("address %s is not in an allowed network", addr)
+}
+
+// checkOrigin rejects browser pages from origins that aren't allowed
+func (a *Allowlist) checkOrigin(r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return errors.New("invalid origin " + origin)
+	}
+	if isLocalOrigin(u, r) {
+		return nil
+	}
+	for _, allowed := range a.Origins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return nil
+		}
+	}
+	return fmt.Errorf("origin %s is not allowed", origin)
+}
+
+// isLocalOrigin reports whether origin is a page served by this server:
+// its port is the one the request arrived on, and its host is localhost,
+// this machine's name or one of its addresses. The Host header isn't
+// compared, the client sets it, so a page of a domain resolving to this
+// machine (DNS rebinding) would match it.
+func isLocalOrigin(origin *url.URL, r *http.Request) bool {
+	local, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	if !ok {
+		return false
+	}
+	localAddr, err := netip.ParseAddrPort(local.String())
+	if err != nil {
+		return false
+	}
+
+	port := origin.Port()
+	if port == "" {
+		port = "80"
+		if origin.Scheme == "https" {
+			port = "443"
+		}
+	}
+	if port != strconv.Itoa(int(localAddr.Port())) {
+		return false
+	}
+
+	host := strings.ToLower(origin.Hostname())
+	if host == "localhost" {
+		return true
+	}
+	if name, err := os.Hostname(); err == nil {
+		if name = strings.ToLower(name); host == name || host == name+".local" {
+			return true
+		}
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	if addr.IsLoopback() || addr == localAddr.Addr().Unmap() {
+		return true
+	}
+	interfaceAddrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+	for _, interfaceAddr := range interfaceAddrs {
+		if prefix, err := netip.ParsePrefix(interfaceAddr.String()); err == nil && prefix.Addr().Unmap() == addr {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckOrigin(t *testing.T) {
+	allowlist := Allowlist{Origins: []string{"https://remote.example.com"}}
+
+	tests := []struct {
+		name   string
+		origin string
+		host   string
+		allow  bool
+	}{
+		{name: "native app", origin: "", host: "192.168.1.10:8080", allow: true},
+		{name: "localhost", origin: "http://localhost:8080", host: "localhost:8080", allow: true},
+		{name: "loopback", origin: "http://127.0.0.1:8080", host: "127.0.0.1:8080", allow: true},
+		{name: "listen address", origin: "http://192.168.1.10:8080", host: "192.168.1.10:8080", allow: true},
+		{name: "allowlisted", origin: "https://remote.example.com", host: "192.168.1.10:8080", allow: true},
+		{name: "dns rebinding", origin: "http://evil.example:8080", host: "evil.example:8080", allow: false},
+		{name: "other port", origin: "http://localhost:3000", host: "localhost:8080", allow: false},
+		{name: "other site", origin: "https://evil.example", host: "192.168.1.10:8080", allow: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+			r.Host = test.host
+			if test.origin != "" {
+				r.Header.Set("Origin", test.origin)
+			}
+			// The request arrived on 192.168.1.10:8080
+			local := &net.TCPAddr{IP: net.ParseIP("192.168.1.10"), Port: 8080}
+			r = r.WithContext(context.WithValue(r.Context(), http.LocalAddrContextKey, local))
+
+			if err := allowlist.checkOrigin(r); (err == nil) != test.allow {
+				t.Errorf("allowed %v (%v), want %v", err == nil, err, test.allow)
+			}
+		})
+	}
+}
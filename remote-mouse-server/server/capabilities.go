@@ -0,0 +1,121 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/tommyalmeida/remote-mouse/mouse"
+	"github.com/tommyalmeida/remote-mouse/mouse/native"
+)
+
+// Features a server can offer, announced in the handshake
+const (
+	FeatureKeyboard      = "keyboard"
+	FeatureUnicode       = "unicode"
+	FeatureScroll        = "scroll"
+	FeatureSmoothScroll  = "smooth_scroll"
+	FeatureMultiMonitor  = "multi_monitor"
+	FeatureAcceleration  = "acceleration"
+	FeatureStabilization = "stabilization"
+)
+
+// Limits the server enforces on every connection
+const (
+	// MaxMessageSize is the largest message accepted, larger ones close the connection
+	MaxMessageSize = 64 * 1024
+	// MaxTextLength is the most characters a single type command may carry
+	MaxTextLength = 1024
+)
+
+// capabilities is what a server can do with its backend
+type capabilities struct {
+	backend  string
+	features map[string]bool
+	buttons  map[mouse.Button]bool
+}
+
+// newCapabilities derives the server's capabilities from its backend
+func newCapabilities(backend native.Backend) capabilities {
+	backendCaps := backend.Capabilities()
+
+	caps := capabilities{
+		backend: backend.Name(),
+		features: map[string]bool{
+			FeatureKeyboard:      backendCaps.Keyboard,
+			FeatureUnicode:       backendCaps.Unicode,
+			FeatureScroll:        backendCaps.Scroll,
+			FeatureSmoothScroll:  backendCaps.SmoothScroll,
+			FeatureMultiMonitor:  backendCaps.MultiMonitor,
+			FeatureAcceleration:  true,
+			FeatureStabilization: true,
+		},
+		buttons: make(map[mouse.Button]bool),
+	}
+	for _, button := range backendCaps.Buttons {
+		caps.buttons[button] = true
+	}
+	return caps
+}
+
+// info describes the capabilities in replies, listing features and buttons
+// in a stable order
+func (c capabilities) info() *CapabilitiesInfo {
+	info := &CapabilitiesInfo{
+		Backend:  c.backend,
+		Features: []string{},
+		Buttons:  []string{},
+		Limits: LimitsInfo{
+			MaxMessageSize: MaxMessageSize,
+			MaxTextLength:  MaxTextLength,
+		},
+	}
+	for _, feature := range []string{
+		FeatureKeyboard, FeatureUnicode, FeatureScroll, FeatureSmoothScroll,
+		FeatureMultiMonitor, FeatureAcceleration, FeatureStabilization,
+	} {
+		if c.features[feature] {
+			info.Features = append(info.Features, feature)
+		}
+	}
+	for _, button := range []mouse.Button{
+		mouse.ButtonLeft, mouse.ButtonRight, mouse.ButtonMiddle, mouse.ButtonBack, mouse.ButtonForward,
+	} {
+		if c.buttons[button] {
+			info.Buttons = append(info.Buttons, button.String())
+		}
+	}
+	return info
+}
+
+// unsupported returns the features in the list the server doesn't offer
+func (c capabilities) unsupported(features []string) []string {
+	var missing []string
+	for _, feature := range features {
+		if !c.features[feature] {
+			missing = append(missing, feature)
+		}
+	}
+	return missing
+}
+
+// check rejects commands needing a feature the server doesn't offer
+func (c capabilities) check(cmd Command) error {
+	switch cmd.Type {
+	case CommandKey, CommandKeyDown, CommandKeyUp, CommandType:
+		if !c.features[FeatureKeyboard] {
+			return unsupportedError(fmt.Errorf("the %s backend can't inject key events", c.backend))
+		}
+	case CommandScroll:
+		if !c.features[FeatureScroll] {
+			return unsupportedError(fmt.Errorf("the %s backend can't scroll", c.backend))
+		}
+	}
+	return nil
+}
+
+// checkButton rejects buttons the backend can't press
+func (c capabilities) checkButton(button mouse.Button) error {
+	if !c.buttons[button] {
+		return unsupportedError(fmt.Errorf("the %s backend has no %s button", c.backend, button))
+	}
+	return nil
+}
@@ -0,0 +1,353 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ControlPolicy decides who gets control when a session asks for it while
+// another one has it
+type ControlPolicy int
+
+const (
+	// ControlFirstWins keeps control with its owner, requests wait in line
+	// until the owner releases control or disconnects
+	ControlFirstWins ControlPolicy = iota
+	// ControlLastWins hands control to whoever asks for it last
+	ControlLastWins
+	// ControlAsk lets the owner grant or deny each request. Requests the
+	// owner doesn't answer within askTimeout are denied, an owner that
+	// is gone loses control once idle instead.
+	ControlAsk
+)
+
+// defaultAskTimeout is how long the owner has to answer a control request
+const defaultAskTimeout = 15 * time.Second
+
+// Control states sent in control replies
+const (
+	// ControlGranted tells the session it has control
+	ControlGranted = "granted"
+	// ControlRevoked tells the session another one took control
+	ControlRevoked = "revoked"
+	// ControlReleased confirms the session gave up control, or its request
+	ControlReleased = "released"
+	// ControlQueued tells the session it waits for control, at Position
+	ControlQueued = "queued"
+	// ControlDenied tells the session the owner refused its request
+	ControlDenied = "denied"
+	// ControlRequested asks the owner to grant or deny control to Requester
+	ControlRequested = "requested"
+)
+
+// Control actions of control commands
+const (
+	ControlActionRequest = "request"
+	ControlActionRelease = "release"
+	ControlActionGrant   = "grant"
+	ControlActionDeny    = "deny"
+)
+
+var controlPolicyNames = map[ControlPolicy]string{
+	ControlFirstWins: "first-wins",
+	ControlLastWins:  "last-wins",
+	ControlAsk:       "ask",
+}
+
+func (p ControlPolicy) String() string {
+	return controlPolicyNames[p]
+}
+
+// ParseControlPolicy returns the policy with the given name
+func ParseControlPolicy(name string) (ControlPolicy, error) {
+	for policy, policyName := range controlPolicyNames {
+		if name == policyName {
+			return policy, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown control policy %q, expected first-wins, last-wins or ask", name)
+}
+
+var (
+	// errNotInControl rejects input from sessions without control
+	errNotInControl = &CommandError{Code: ErrorControl, Err: errors.New("another device has control, send a control request to ask for it")}
+	// errInputDropped is errNotInControl once it was reported, it is only
+	// sent again for commands with an id
+	errInputDropped = &CommandError{Code: ErrorControl, Err: errNotInControl.Err}
+)
+
+// controlNotice is a control reply to send once the arbiter is unlocked
+type controlNotice struct {
+	session *session
+	info    ControlInfo
+}
+
+// arbiter gives control of the cursor to one session at a time, so
+// several connected phones don't fight over it.
+// Sessions without control can't send input, a session that sends input
+// while nobody has control takes it. An owner that sends no input for
+// idleTimeout loses control, e.g. a phone whose app went to the background.
+type arbiter struct {
+	policy     ControlPolicy
+	askTimeout time.Duration
+
+	owner *session
+	// lastInput is when the owner got control or last sent input
+	lastInput   time.Time
+	idleTimeout time.Duration
+	// idle releases control of an idle owner
+	idle *time.Timer
+	// waiting are the sessions that asked for control, oldest first
+	waiting []*session
+	// asked is the request the owner was asked about with ControlAsk,
+	// denied by timer unless answered
+	asked *session
+	timer *time.Timer
+	// notices are sent when the mutex is released
+	notices []controlNotice
+	mutex   sync.Mutex
+}
+
+// newArbiter creates an arbiter nobody has control of
+func newArbiter(policy ControlPolicy) *arbiter {
+	return &arbiter{policy: policy, askTimeout: defaultAskTimeout}
+}
+
+// setIdleTimeout sets how long the owner keeps control without sending
+// input, 0 keeps it until it releases control or disconnects
+func (a *arbiter) setIdleTimeout(timeout time.Duration) {
+	a.mutex.Lock()
+	defer a.unlock()
+
+	a.idleTimeout = timeout
+	a.watchIdle(timeout)
+}
+
+// unlock releases the mutex and sends the notices collected while holding
+// it. Neither the arbiter nor the session that caused a notice waits for a
+// slow client.
+func (a *arbiter) unlock() {
+	notices := a.notices
+	a.notices = nil
+	a.mutex.Unlock()
+
+	for _, notice := range notices {
+		notice.session.notify(Reply{Version: ProtocolVersion, Type: ReplyControl, Control: &notice.info})
+	}
+}
+
+// notify queues a control reply for a session
+func (a *arbiter) notify(s *session, info ControlInfo) {
+	s.inputRejected.Store(false)
+	a.notices = append(a.notices, controlNotice{session: s, info: info})
+}
+
+// acquire reports whether the session may send input, giving it control
+// if nobody has it
+func (a *arbiter) acquire(s *session) bool {
+	a.mutex.Lock()
+	defer a.unlock()
+
+	// A datagram accepted just before its session ended can still arrive
+	if s.left {
+		return false
+	}
+	if a.owner == nil {
+		a.grant(s)
+	}
+	if a.owner != s {
+		return false
+	}
+
+	a.lastInput = time.Now()
+	if a.idle == nil {
+		a.watchIdle(a.idleTimeout)
+	}
+	return true
+}
+
+// request asks for control following the policy
+func (a *arbiter) request(s *session) {
+	a.mutex.Lock()
+	defer a.unlock()
+
+	switch {
+	case s.left:
+	case a.owner == nil || a.owner == s || a.policy == ControlLastWins:
+		a.grant(s)
+	case a.position(s) > 0:
+		a.notify(s, ControlInfo{State: ControlQueued, Position: a.position(s)})
+	default:
+		a.waiting = append(a.waiting, s)
+		a.notify(s, ControlInfo{State: ControlQueued, Position: len(a.waiting)})
+		a.ask()
+	}
+}
+
+// release gives up control, or withdraws a request
+func (a *arbiter) release(s *session) {
+	a.mutex.Lock()
+	defer a.unlock()
+
+	a.notify(s, ControlInfo{State: ControlReleased})
+	a.remove(s)
+}
+
+// answer grants or denies the request the owner was asked about
+func (a *arbiter) answer(s *session, grant bool) error {
+	a.mutex.Lock()
+	defer a.unlock()
+
+	if a.owner != s || a.asked == nil {
+		return validationError(errors.New("there is no control request to answer"))
+	}
+
+	if grant {
+		a.grant(a.asked)
+	} else {
+		a.deny(a.asked)
+	}
+	return nil
+}
+
+// leave forgets a closed session, passing control on if it had it. The
+// session can't get control afterwards.
+func (a *arbiter) leave(s *session) {
+	a.mutex.Lock()
+	defer a.unlock()
+
+	s.left = true
+	a.remove(s)
+}
+
+// remove takes a session out of line, passing control to the next one
+// waiting if it had it
+func (a *arbiter) remove(s *session) {
+	a.waiting = removeSession(a.waiting, s)
+	if a.asked == s {
+		a.stopAsking()
+		a.ask()
+	}
+
+	if a.owner == s {
+		a.owner = nil
+		if len(a.waiting) > 0 {
+			a.grant(a.waiting[0])
+		} else {
+			a.watchIdle(0)
+		}
+	}
+}
+
+// grant gives control to a session, taking it from the current owner
+func (a *arbiter) grant(s *session) {
+	if a.owner != nil && a.owner != s {
+		a.notify(a.owner, ControlInfo{State: ControlRevoked})
+	}
+	a.owner = s
+	a.lastInput = time.Now()
+	a.watchIdle(a.idleTimeout)
+	a.waiting = removeSession(a.waiting, s)
+	a.notify(s, ControlInfo{State: ControlGranted})
+
+	// The new owner answers the requests still waiting
+	a.stopAsking()
+	a.ask()
+}
+
+// ask asks the owner about the oldest request with ControlAsk
+func (a *arbiter) ask() {
+	if a.policy != ControlAsk || a.owner == nil || a.asked != nil || len(a.waiting) == 0 {
+		return
+	}
+
+	requester := a.waiting[0]
+	a.asked = requester
+	a.notify(a.owner, ControlInfo{State: ControlRequested, Requester: requester.name()})
+	var timer *time.Timer
+	timer = time.AfterFunc(a.askTimeout, func() {
+		a.mutex.Lock()
+		defer a.unlock()
+
+		// A timer stopped too late must not deny a newer request
+		if a.timer == timer {
+			a.deny(requester)
+		}
+	})
+	a.timer = timer
+}
+
+// deny refuses the request the owner was asked about, and asks about the
+// next one
+func (a *arbiter) deny(requester *session) {
+	a.stopAsking()
+	a.waiting = removeSession(a.waiting, requester)
+	a.notify(requester, ControlInfo{State: ControlDenied})
+	a.ask()
+}
+
+// watchIdle restarts the timer releasing control of an idle owner, firing
+// after delay. It stops the timer if nobody has control or idleTimeout is 0.
+func (a *arbiter) watchIdle(delay time.Duration) {
+	if a.idle != nil {
+		a.idle.Stop()
+		a.idle = nil
+	}
+	if a.owner == nil || a.idleTimeout <= 0 || delay <= 0 {
+		return
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(delay, func() {
+		a.mutex.Lock()
+		defer a.unlock()
+
+		// A timer stopped too late must not release a newer owner
+		if a.idle != timer {
+			return
+		}
+		a.idle = nil
+
+		// Input since the timer started moves the deadline instead of
+		// restarting the timer for every message
+		if idle := time.Since(a.lastInput); idle < a.idleTimeout {
+			a.watchIdle(a.idleTimeout - idle)
+			return
+		}
+		owner := a.owner
+		a.notify(owner, ControlInfo{State: ControlReleased})
+		a.remove(owner)
+	})
+	a.idle = timer
+}
+
+// stopAsking forgets the request the owner was asked about
+func (a *arbiter) stopAsking() {
+	if a.timer != nil {
+		a.timer.Stop()
+	}
+	a.asked, a.timer = nil, nil
+}
+
+// position returns a session's place in line counting from 1, 0 if it
+// isn't waiting
+func (a *arbiter) position(s *session) int {
+	for i, waiting := range a.waiting {
+		if waiting == s {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// removeSession removes a session from a list, keeping the order
+func removeSession(sessions []*session, s *session) []*session {
+	for i, other := range sessions {
+		if other == s {
+			return append(sessions[:i], sessions[i+1:]...)
+		}
+	}
+	return sessions
+}
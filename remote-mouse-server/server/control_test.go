@@ -0,0 +1,182 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// testSession creates a session without a connection, its replies stay
+// queued in outgoing
+func testSession(name string) *session {
+	return &session{
+		remoteAddr: name,
+		outgoing:   make(chan []byte, outgoingQueueSize),
+		done:       make(chan struct{}),
+	}
+}
+
+// replies returns the replies queued for a session, joined by spaces
+func replies(s *session) string {
+	var queued []string
+	for {
+		select {
+		case message := <-s.outgoing:
+			queued = append(queued, string(message))
+		default:
+			return strings.Join(queued, " ")
+		}
+	}
+}
+
+func TestIdleOwnerLosesControl(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy ControlPolicy
+		// waiting asks for control before the owner goes idle
+		waiting bool
+	}{
+		{name: "nobody waiting", policy: ControlFirstWins},
+		{name: "first-wins", policy: ControlFirstWins, waiting: true},
+		{name: "ask", policy: ControlAsk, waiting: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			arbiter := newArbiter(test.policy)
+			arbiter.setIdleTimeout(50 * time.Millisecond)
+			owner, other := testSession("owner"), testSession("other")
+
+			if !arbiter.acquire(owner) {
+				t.Fatal("owner didn't get control")
+			}
+			if test.waiting {
+				arbiter.request(other)
+			}
+
+			// Input keeps control
+			for i := 0; i < 4; i++ {
+				time.Sleep(20 * time.Millisecond)
+				if !arbiter.acquire(owner) {
+					t.Fatal("owner lost control while sending input")
+				}
+			}
+			if arbiter.acquire(other) {
+				t.Fatal("other took control from an active owner")
+			}
+			replies(owner)
+			replies(other)
+
+			// Once the owner is idle, control passes to the waiting
+			// session, which loses it in turn without sending input
+			time.Sleep(150 * time.Millisecond)
+			if got := replies(owner); got != "control:released" {
+				t.Errorf("owner told %q, want control:released", got)
+			}
+			want := ""
+			if test.waiting {
+				want = "control:granted control:released"
+			}
+			if got := replies(other); got != want {
+				t.Errorf("other told %q, want %q", got, want)
+			}
+			if !arbiter.acquire(other) {
+				t.Error("other can't take control from an idle owner")
+			}
+		})
+	}
+}
+
+func TestUnansweredRequestDenied(t *testing.T) {
+	arbiter := newArbiter(ControlAsk)
+	arbiter.askTimeout = 20 * time.Millisecond
+	owner, other := testSession("owner"), testSession("other")
+
+	arbiter.acquire(owner)
+	arbiter.request(other)
+	time.Sleep(60 * time.Millisecond)
+
+	if got := replies(other); got != "control:queued;position=1 control:denied" {
+		t.Errorf("requester told %q, want control:denied", got)
+	}
+	if !arbiter.acquire(owner) || arbiter.acquire(other) {
+		t.Error("control changed hands")
+	}
+}
+
+func TestLeftSessionDoesntGetControl(t *testing.T) {
+	arbiter := newArbiter(ControlFirstWins)
+	gone, other := testSession("gone"), testSession("other")
+
+	arbiter.acquire(gone)
+	arbiter.leave(gone)
+
+	// Like a datagram accepted just before the session ended
+	if arbiter.acquire(gone) {
+		t.Fatal("a session that left got control")
+	}
+	arbiter.request(gone)
+	if !arbiter.acquire(other) {
+		t.Error("control is stuck with a session that left")
+	}
+}
+
+// stalledSession creates a session on a real connection whose replies are
+// never written, like one to a client that stopped reading. The client's
+// end of the connection is returned with it.
+func stalledSession(t *testing.T) (*session, *websocket.Conn) {
+	t.Helper()
+
+	upgraded := make(chan *websocket.Conn, 1)
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil); err == nil {
+			upgraded <- conn
+		}
+	}))
+	t.Cleanup(httpServer.Close)
+
+	client := dial(t, "ws"+strings.TrimPrefix(httpServer.URL, "http"))
+	s := testSession("stalled")
+	s.conn = <-upgraded
+	t.Cleanup(func() { s.conn.Close() })
+	return s, client
+}
+
+func TestSlowOwnerDoesntStallRequests(t *testing.T) {
+	arbiter := newArbiter(ControlAsk)
+	owner, client := stalledSession(t)
+	other := testSession("other")
+
+	arbiter.acquire(owner)
+	for len(owner.outgoing) < outgoingQueueSize {
+		owner.outgoing <- []byte("control:granted")
+	}
+
+	// Asking the owner must not wait for room in its queue
+	requested := make(chan struct{})
+	go func() {
+		arbiter.request(other)
+		close(requested)
+	}()
+	select {
+	case <-requested:
+	case <-time.After(time.Second):
+		t.Fatal("request waited for the stalled owner")
+	}
+
+	// The owner is disconnected instead of missing the notice
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var netErr net.Error
+	if _, _, err := client.ReadMessage(); err == nil || errors.As(err, &netErr) && netErr.Timeout() {
+		t.Errorf("read %v, want the connection closed", err)
+	}
+	if got := replies(other); got != "control:queued;position=1" {
+		t.Errorf("requester told %q, want control:queued;position=1", got)
+	}
+}
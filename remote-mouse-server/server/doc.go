@@ -0,0 +1,13 @@
+// Package server exposes the mouse and keyboard controllers over WebSocket.
+//
+// A connection speaks one of two message formats, picked from its first
+// text message: the legacy text commands ("10,5", "click:left", ...) or
+// versioned JSON envelopes ({"v":1,"type":"move",...}). Replies use the
+// same format as the connection.
+//
+// Movement, button and scroll events may also be sent as binary WebSocket
+// messages on either kind of connection. Binary frames have the fixed
+// 24-byte layout described on Frame and are decoded without allocating,
+// which keeps high-rate gyroscope and touchpad input cheap. The package
+// benchmarks compare their throughput with the text formats.
+package server
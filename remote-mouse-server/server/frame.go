@@ -0,0 +1,92 @@
+package server
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// FrameSize is the size of every binary frame in bytes
+const FrameSize = 24
+
+// Frame types
+const (
+	// FrameMove moves the cursor by DX,DY pixels
+	FrameMove byte = 1
+	// FrameButton presses (State 1) or releases (State 0) Button
+	FrameButton byte = 2
+	// FrameScroll scrolls by DX,DY wheel detents
+	FrameScroll byte = 3
+)
+
+// Frame is a decoded binary WebSocket message. Binary frames carry the
+// high-rate input (gyroscope and touchpad motion) in a fixed layout that
+// decodes without allocating. All fields are little-endian:
+//
+//	offset  size  field
+//	0       1     type       FrameMove, FrameButton or FrameScroll
+//	1       1     button     mouse button for FrameButton: 0 left, 1 right, 2 middle, 3 back, 4 forward
+//	2       1     state      1 down, 0 up for FrameButton
+//	3       1     reserved   must be 0
+//	4       4     sequence   uint32, incremented by the client for every frame
+//	8       8     timestamp  uint64, client clock in milliseconds
+//	16      4     dx         float32
+//	20      4     dy         float32
+type Frame struct {
+	Type      byte
+	Button    byte
+	State     byte
+	Sequence  uint32
+	Timestamp uint64
+	DX        float32
+	DY        float32
+}
+
+// Frame decoding errors, preallocated so decoding never allocates
+var (
+	ErrFrameSize     = errors.New("binary frame must be 24 bytes")
+	ErrFrameReserved = errors.New("binary frame reserved byte must be 0")
+	ErrFrameValue    = errors.New("binary frame delta is not a finite number")
+)
+
+// DecodeFrame decodes a binary frame into frame
+func DecodeFrame(data []byte, frame *Frame) error {
+	if len(data) != FrameSize {
+		return ErrFrameSize
+	}
+	if data[3] != 0 {
+		return ErrFrameReserved
+	}
+
+	frame.Type = data[0]
+	frame.Button = data[1]
+	frame.State = data[2]
+	frame.Sequence = binary.LittleEndian.Uint32(data[4:])
+	frame.Timestamp = binary.LittleEndian.Uint64(data[8:])
+	frame.DX = math.Float32frombits(binary.LittleEndian.Uint32(data[16:]))
+	frame.DY = math.Float32frombits(binary.LittleEndian.Uint32(data[20:]))
+
+	if !finite(frame.DX) || !finite(frame.DY) {
+		return ErrFrameValue
+	}
+	return nil
+}
+
+// EncodeFrame writes frame into data, which must be at least FrameSize bytes
+func EncodeFrame(data []byte, frame *Frame) {
+	_ = data[FrameSize-1]
+
+	data[0] = frame.Type
+	data[1] = frame.Button
+	data[2] = frame.State
+	data[3] = 0
+	binary.LittleEndian.PutUint32(data[4:], frame.Sequence)
+	binary.LittleEndian.PutUint64(data[8:], frame.Timestamp)
+	binary.LittleEndian.PutUint32(data[16:], math.Float32bits(frame.DX))
+	binary.LittleEndian.PutUint32(data[20:], math.Float32bits(frame.DY))
+}
+
+// finite reports whether f is neither NaN nor infinite
+func finite(f float32) bool {
+	return !math.IsNaN(float64(f)) && !math.IsInf(float64(f), 0)
+}
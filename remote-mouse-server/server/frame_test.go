@@ -0,0 +1,128 @@
+package server
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/tommyalmeida/remote-mouse/mouse/native"
+)
+
+var (
+	benchFrame = make([]byte, FrameSize)
+	benchText  = []byte("12,-7")
+	benchJSON  = []byte(`{"v":1,"type":"move","dx":12,"dy":-7}`)
+)
+
+func init() {
+	EncodeFrame(benchFrame, &Frame{Type: FrameMove, Sequence: 42, Timestamp: 1718000000000, DX: 12, DY: -7})
+}
+
+func TestDecodeFrame(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want Frame
+		err  error
+	}{
+		{name: "move", data: benchFrame, want: Frame{Type: FrameMove, Sequence: 42, Timestamp: 1718000000000, DX: 12, DY: -7}},
+		{name: "short", data: benchFrame[:FrameSize-1], err: ErrFrameSize},
+		{name: "reserved", data: append([]byte{1, 0, 0, 1}, benchFrame[4:]...), err: ErrFrameReserved},
+		{name: "nan", data: append(append([]byte(nil), benchFrame[:16]...), 0, 0, 0xc0, 0x7f, 0, 0, 0, 0), err: ErrFrameValue},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var frame Frame
+			err := DecodeFrame(test.data, &frame)
+			if err != test.err {
+				t.Fatalf("error %v, want %v", err, test.err)
+			}
+			if err == nil && frame != test.want {
+				t.Errorf("frame %+v, want %+v", frame, test.want)
+			}
+		})
+	}
+}
+
+func TestDecodeFrameAllocations(t *testing.T) {
+	var frame Frame
+	allocs := testing.AllocsPerRun(1000, func() {
+		DecodeFrame(benchFrame, &frame)
+	})
+	if allocs != 0 {
+		t.Errorf("DecodeFrame allocates %g times, want 0", allocs)
+	}
+}
+
+func BenchmarkDecodeFrame(b *testing.B) {
+	var frame Frame
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := DecodeFrame(benchFrame, &frame); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseText(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := ParseCommand(FormatText, benchText); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseJSON(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := ParseCommand(FormatJSON, benchJSON); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkConnection measures movement end to end through a WebSocket
+// connection with the null backend, so only the protocol overhead counts
+func BenchmarkConnection(b *testing.B) {
+	formats := []struct {
+		name        string
+		hello       string
+		messageType int
+		message     []byte
+		query       string
+	}{
+		{"binary", "hello:", websocket.BinaryMessage, benchFrame, "query:displays"},
+		{"text", "hello:", websocket.TextMessage, benchText, "query:displays"},
+		{"json", `{"v":1,"type":"hello"}`, websocket.TextMessage, benchJSON, `{"v":1,"type":"query","query":"displays"}`},
+	}
+
+	for _, format := range formats {
+		b.Run(format.name, func(b *testing.B) {
+			_, url := serveBackend(b, native.NewNull())
+			conn := dial(b, url)
+			conn.WriteMessage(websocket.TextMessage, []byte(format.hello))
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := conn.WriteMessage(format.messageType, format.message); err != nil {
+					b.Fatal(err)
+				}
+			}
+
+			// Messages are handled in order, so the answer to the query
+			// means every movement before it was handled
+			conn.WriteMessage(websocket.TextMessage, []byte(format.query))
+			for {
+				_, message, err := conn.ReadMessage()
+				if err != nil {
+					b.Fatal(err)
+				}
+				if strings.HasPrefix(string(message), "displays:") || strings.Contains(string(message), `"type":"displays"`) {
+					break
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/tommyalmeida/remote-mouse/keyboard"
+	"github.com/tommyalmeida/remote-mouse/mouse"
+)
+
+// heldInput tracks the buttons and keys a session pressed and hasn't
+// released, so they can be released when the session ends or goes idle
+// instead of leaving the desktop stuck mid-drag
+type heldInput struct {
+	buttons map[mouse.Button]bool
+	keys    map[keyboard.Key]bool
+	// timer releases everything after the idle timeout
+	timer *time.Timer
+	mutex sync.Mutex
+}
+
+// setButton records a button press or release
+func (h *heldInput) setButton(button mouse.Button, down bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.buttons == nil {
+		h.buttons = make(map[mouse.Button]bool)
+	}
+	if down {
+		h.buttons[button] = true
+	} else {
+		delete(h.buttons, button)
+	}
+}
+
+// setKey records a key press or release
+func (h *heldInput) setKey(key keyboard.Key, down bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.keys == nil {
+		h.keys = make(map[keyboard.Key]bool)
+	}
+	if down {
+		h.keys[key] = true
+	} else {
+		delete(h.keys, key)
+	}
+}
+
+// watch restarts the idle timer while anything is held, release is called
+// once nothing was sent for timeout
+func (h *heldInput) watch(timeout time.Duration, release func()) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if len(h.buttons) == 0 && len(h.keys) == 0 {
+		if h.timer != nil {
+			h.timer.Stop()
+		}
+		return
+	}
+	if h.timer == nil {
+		h.timer = time.AfterFunc(timeout, release)
+	} else {
+		h.timer.Reset(timeout)
+	}
+}
+
+// take returns everything held and forgets it
+func (h *heldInput) take() (buttons []mouse.Button, keys []keyboard.Key) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for button := range h.buttons {
+		buttons = append(buttons, button)
+	}
+	for key := range h.keys {
+		keys = append(keys, key)
+	}
+	h.buttons, h.keys = nil, nil
+	if h.timer != nil {
+		h.timer.Stop()
+	}
+	return buttons, keys
+}
@@ -0,0 +1,196 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// pinDigits is the length of pairing PINs
+	pinDigits = 6
+	// maxPINAttempts wrong PINs in a row lock pairing for pairingLockout
+	maxPINAttempts = 5
+	pairingLockout = time.Minute
+	// deviceTokenSize is the number of random bytes in a device token
+	deviceTokenSize = 32
+)
+
+var (
+	errWrongPIN      = errors.New("wrong pairing PIN")
+	errPairingLocked = errors.New("too many wrong PINs, pairing is locked for a minute")
+	errUnknownToken  = errors.New("unknown device token, pair the device again")
+)
+
+// Device is a client that completed pairing
+type Device struct {
+	Name string `json:"name"`
+	// TokenHash is the hex encoded SHA-256 of the device token, the token
+	// itself is only known to the device
+	TokenHash string    `json:"token_hash"`
+	Paired    time.Time `json:"paired"`
+}
+
+// Pairing hands out device tokens to clients that know the PIN shown on
+// the server, and authenticates connections by their token.
+//
+// The PIN is single use: a new one is printed after every pairing, and
+// after maxPINAttempts wrong guesses, when pairing is also locked for a
+// while so the PIN can't be brute forced.
+type Pairing struct {
+	// path is the file devices are stored in, empty keeps them in memory
+	path    string
+	verbose bool
+
+	devices     []Device
+	pin         string
+	attempts    int
+	lockedUntil time.Time
+	mutex       sync.Mutex
+}
+
+// DefaultPairingPath returns the file paired devices are stored in:
+// remote-mouse/devices.json in the user's config directory
+func DefaultPairingPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "remote-mouse", "devices.json"), nil
+}
+
+// NewPairing loads the devices paired so far from path and prints the
+// first PIN. An empty path keeps paired devices in memory only.
+func NewPairing(path string, verbose bool) (*Pairing, error) {
+	p := &Pairing{path: path, verbose: verbose}
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		if err == nil {
+			if err := json.Unmarshal(data, &p.devices); err != nil {
+				return nil, fmt.Errorf("invalid devices file %s: %w", path, err)
+			}
+		}
+	}
+
+	if err := p.newPIN(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Devices returns the paired devices
+func (p *Pairing) Devices() []Device {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return append([]Device(nil), p.devices...)
+}
+
+// Pair checks the PIN and returns a new device token for the named device
+func (p *Pairing) Pair(pin, name string) (string, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if time.Now().Before(p.lockedUntil) {
+		return "", errPairingLocked
+	}
+	if subtle.ConstantTimeCompare([]byte(pin), []byte(p.pin)) != 1 {
+		p.attempts++
+		if p.attempts >= maxPINAttempts {
+			p.lockedUntil = time.Now().Add(pairingLockout)
+			if err := p.newPIN(); err != nil {
+				return "", err
+			}
+		}
+		return "", errWrongPIN
+	}
+
+	raw := make([]byte, deviceTokenSize)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	if name == "" {
+		name = "unnamed device"
+	}
+	p.devices = append(p.devices, Device{Name: name, TokenHash: hashToken(token), Paired: time.Now().UTC()})
+	if err := p.save(); err != nil {
+		p.devices = p.devices[:len(p.devices)-1]
+		return "", fmt.Errorf("failed to store device: %w", err)
+	}
+
+	if p.verbose {
+		fmt.Printf("Paired device %q\n", name)
+	}
+	return token, p.newPIN()
+}
+
+// Authenticate returns the device a token was issued to
+func (p *Pairing) Authenticate(token string) (Device, error) {
+	hash := []byte(hashToken(token))
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for _, device := range p.devices {
+		if subtle.ConstantTimeCompare(hash, []byte(device.TokenHash)) == 1 {
+			return device, nil
+		}
+	}
+	return Device{}, errUnknownToken
+}
+
+// newPIN replaces the PIN and shows it to the user
+func (p *Pairing) newPIN() error {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(math.Pow10(pinDigits))))
+	if err != nil {
+		return err
+	}
+
+	p.pin = fmt.Sprintf("%0*d", pinDigits, n)
+	p.attempts = 0
+	fmt.Printf("Pairing PIN: %s\n", p.pin)
+	return nil
+}
+
+// save writes the devices to the devices file, replacing it atomically
+func (p *Pairing) save() error {
+	if p.path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(p.path), 0o700); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(p.devices, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := p.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p.path)
+}
+
+// hashToken returns the hex encoded SHA-256 of a device token
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
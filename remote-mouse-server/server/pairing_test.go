@@ -0,0 +1,177 @@
+package server
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/tommyalmeida/remote-mouse/mouse/native"
+)
+
+// wrongPIN returns a PIN that isn't the current one
+func wrongPIN(p *Pairing) string {
+	if p.pin == "000000" {
+		return "000001"
+	}
+	return "000000"
+}
+
+func TestPairingLockout(t *testing.T) {
+	p, err := NewPairing("", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pin := p.pin
+
+	for i := 1; i < maxPINAttempts; i++ {
+		if _, err := p.Pair(wrongPIN(p), "guess"); !errors.Is(err, errWrongPIN) {
+			t.Fatalf("attempt %d: error %v, want %v", i, err, errWrongPIN)
+		}
+	}
+	if p.pin != pin {
+		t.Fatal("PIN changed before the last attempt")
+	}
+
+	// The last wrong attempt locks pairing and replaces the PIN
+	if _, err := p.Pair(wrongPIN(p), "guess"); !errors.Is(err, errWrongPIN) {
+		t.Fatalf("last attempt: error %v, want %v", err, errWrongPIN)
+	}
+	if _, err := p.Pair(p.pin, "guess"); !errors.Is(err, errPairingLocked) {
+		t.Fatalf("error %v while locked, want %v", err, errPairingLocked)
+	}
+	if p.pin == pin {
+		t.Fatal("PIN wasn't regenerated after the lockout")
+	}
+
+	// Once the lock expires the new PIN works, and the old one doesn't
+	p.lockedUntil = time.Now()
+	if pin != p.pin {
+		if _, err := p.Pair(pin, "old PIN"); !errors.Is(err, errWrongPIN) {
+			t.Errorf("old PIN: error %v, want %v", err, errWrongPIN)
+		}
+	}
+	if _, err := p.Pair(p.pin, "new PIN"); err != nil {
+		t.Errorf("new PIN: %v", err)
+	}
+}
+
+func TestPairingSingleUsePIN(t *testing.T) {
+	p, err := NewPairing("", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pin := p.pin
+
+	if _, err := p.Pair(pin, "phone"); err != nil {
+		t.Fatal(err)
+	}
+	if p.pin == pin {
+		t.Skip("the new PIN happens to be the same")
+	}
+	if _, err := p.Pair(pin, "tablet"); !errors.Is(err, errWrongPIN) {
+		t.Errorf("reused PIN: error %v, want %v", err, errWrongPIN)
+	}
+	if devices := p.Devices(); len(devices) != 1 {
+		t.Errorf("%d devices, want 1", len(devices))
+	}
+}
+
+func TestPairingStoredToken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "remote-mouse", "devices.json")
+	p, err := NewPairing(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := p.Pair(p.pin, "Pixel 8")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The file only holds a hash of the token
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), token) {
+		t.Error("the devices file holds the token")
+	}
+
+	// After a restart the token still authenticates the device
+	restarted, err := NewPairing(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	device, err := restarted.Authenticate(token)
+	if err != nil || device.Name != "Pixel 8" {
+		t.Errorf("device %+v, %v, want Pixel 8", device, err)
+	}
+
+	for _, unknown := range []string{"", "bogus", token[:len(token)-1], device.TokenHash} {
+		if _, err := restarted.Authenticate(unknown); !errors.Is(err, errUnknownToken) {
+			t.Errorf("token %q: error %v, want %v", unknown, err, errUnknownToken)
+		}
+	}
+}
+
+func TestPairingConnection(t *testing.T) {
+	pairing, err := NewPairing("", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := testConfig()
+	virtual := native.NewVirtual(1920, 1080)
+	config.Backend = virtual
+	config.Pairing = pairing
+	srv, url := serveConfig(t, config)
+
+	conn := dial(t, url)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, message, err := conn.ReadMessage(); err != nil || !strings.Contains(string(message), ";auth=required") {
+		t.Fatalf("greeting %q, %v, want auth=required", message, err)
+	}
+
+	// Input is refused until the device pairs
+	conn.WriteMessage(websocket.TextMessage, []byte("10,0"))
+	conn.WriteMessage(websocket.BinaryMessage, frame(FrameMove, 0, 0, 10, 0))
+	conn.WriteMessage(websocket.TextMessage, []byte("pair:"+wrongPIN(pairing)+",Pixel 8"))
+	want := []string{
+		"error:unauthorized:" + escapeText(errNotAuthenticated.Error()),
+		"error:unauthorized:" + escapeText(errNotAuthenticated.Error()),
+		"error:unauthorized:" + errWrongPIN.Error(),
+	}
+	if got := readReplies(t, conn, 3); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("replies:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	conn.WriteMessage(websocket.TextMessage, []byte("pair:"+pairing.pin+",Pixel 8"))
+	token, ok := strings.CutPrefix(readReplies(t, conn, 1)[0], "paired:token=")
+	if !ok {
+		t.Fatal("not paired")
+	}
+	conn.WriteMessage(websocket.TextMessage, []byte("5,0"))
+	hangUp(t, srv, conn)
+
+	// A later connection authenticates with the token, an unknown one is
+	// rejected
+	conn = dial(t, url)
+	conn.WriteMessage(websocket.TextMessage, []byte("auth:bogus"))
+	conn.WriteMessage(websocket.TextMessage, []byte("auth:"+token))
+	conn.WriteMessage(websocket.TextMessage, []byte("0,5"))
+	want = []string{"error:unauthorized:" + escapeText(errUnknownToken.Error()), "authenticated:"}
+	if got := readReplies(t, conn, 2); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("replies:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	hangUp(t, srv, conn)
+
+	var events []string
+	for _, event := range virtual.Events() {
+		events = append(events, event.String())
+	}
+	if got := strings.Join(events, "\n"); got != "move 965,540\nmove 965,545" {
+		t.Errorf("events:\n%s\nwant only the moves after pairing", got)
+	}
+}
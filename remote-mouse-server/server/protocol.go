@@ -0,0 +1,552 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ProtocolVersion is the version of the JSON message protocol
+const ProtocolVersion = 1
+
+// Format is the wire format a connection speaks
+type Format int
+
+const (
+	// FormatText is the legacy format: "10,5", "click:left", "config:speed=1.5", ...
+	FormatText Format = iota
+	// FormatJSON is the versioned envelope format: {"v":1,"type":"move","dx":10,"dy":5}
+	FormatJSON
+)
+
+func (f Format) String() string {
+	if f == FormatJSON {
+		return "json"
+	}
+	return "text"
+}
+
+// detectFormat picks the format from a connection's first message.
+// JSON messages are objects, no text message starts with '{'.
+func detectFormat(message []byte) Format {
+	if trimmed := bytes.TrimSpace(message); len(trimmed) > 0 && trimmed[0] == '{' {
+		return FormatJSON
+	}
+	return FormatText
+}
+
+// Command types
+const (
+	CommandMove      = "move"
+	CommandClick     = "click"
+	CommandButton    = "button"
+	CommandScroll    = "scroll"
+	CommandKey       = "key"
+	CommandKeyDown   = "keydown"
+	CommandKeyUp     = "keyup"
+	CommandType      = "type"
+	CommandConfig    = "config"
+	CommandStabilize = "stabilize"
+	CommandQuery     = "query"
+	// CommandHello opens the handshake, announcing the client's features
+	CommandHello = "hello"
+	// CommandPair exchanges the PIN shown on the server for a device token
+	CommandPair = "pair"
+	// CommandAuth authenticates the connection with a device token
+	CommandAuth = "auth"
+	// CommandControl requests, releases, grants or denies control
+	CommandControl = "control"
+)
+
+// Command is a decoded client message, whichever format it arrived in.
+// Only the fields used by its type are set.
+type Command struct {
+	// Version is the protocol version, always ProtocolVersion for text messages
+	Version int    `json:"v"`
+	Type    string `json:"type"`
+	// ID is an optional client chosen identifier, echoed in replies
+	ID string `json:"id,omitempty"`
+	// Timestamp is the client's clock when sending, in milliseconds
+	Timestamp int64 `json:"ts,omitempty"`
+
+	// DX and DY are the move delta in pixels or the scroll amount in detents
+	DX float64 `json:"dx,omitempty"`
+	DY float64 `json:"dy,omitempty"`
+
+	// Button names the button of click and button commands
+	Button string `json:"button,omitempty"`
+	// State is "down" or "up" for button commands
+	State string `json:"state,omitempty"`
+	// Double makes a click a double click
+	Double bool `json:"double,omitempty"`
+
+	// Key is a key name, or a combination like "ctrl+shift+t" for key commands
+	Key string `json:"key,omitempty"`
+	// Text is typed by type commands
+	Text string `json:"text,omitempty"`
+
+	// Query names what a query command asks for, e.g. "displays"
+	Query string `json:"query,omitempty"`
+
+	// Settings holds the values of config and stabilize commands
+	Settings map[string]json.RawMessage `json:"settings,omitempty"`
+
+	// Client describes the client application in hello commands
+	Client string `json:"client,omitempty"`
+	// Features lists the features the client uses, in hello commands
+	Features []string `json:"features,omitempty"`
+
+	// PIN is the pairing PIN of pair commands, which also name the device
+	// in Client
+	PIN string `json:"pin,omitempty"`
+	// Token is the device token of auth commands
+	Token string `json:"token,omitempty"`
+
+	// Action is request, release, grant or deny for control commands
+	Action string `json:"action,omitempty"`
+}
+
+// SettingKeys returns the keys of the command's settings in the order they
+// must be applied: sorted, with "enable" last so it sees the other settings
+func (c Command) SettingKeys() []string {
+	keys := make([]string, 0, len(c.Settings))
+	for key := range c.Settings {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i] == "enable" || keys[j] == "enable" {
+			return keys[j] == "enable" && keys[i] != "enable"
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+// Setting returns a setting in the legacy "key=value" value syntax.
+// Strings are unquoted, numbers and booleans kept as written, and an
+// object like {"profile":"power","exponent":2} becomes "power,exponent=2".
+func (c Command) Setting(key string) (string, error) {
+	raw := c.Settings[key]
+
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return "", fmt.Errorf("invalid value for %s: %w", key, err)
+	}
+
+	switch value := value.(type) {
+	case string:
+		return value, nil
+	case json.Number:
+		return value.String(), nil
+	case bool:
+		return strconv.FormatBool(value), nil
+	case map[string]interface{}:
+		profile, ok := value["profile"].(string)
+		if !ok {
+			return "", fmt.Errorf("invalid value for %s: objects need a \"profile\" name", key)
+		}
+		params := make([]string, 0, len(value))
+		for param, paramValue := range value {
+			if param == "profile" {
+				continue
+			}
+			number, ok := paramValue.(json.Number)
+			if !ok {
+				return "", fmt.Errorf("invalid value for %s.%s: expected a number", key, param)
+			}
+			params = append(params, param+"="+number.String())
+		}
+		sort.Strings(params)
+		return strings.Join(append([]string{profile}, params...), ","), nil
+	}
+	return "", fmt.Errorf("invalid value for %s: %s", key, raw)
+}
+
+// ParseCommand decodes a message in the given format. Errors are
+// CommandErrors, parse errors unless the protocol version is unsupported.
+func ParseCommand(format Format, message []byte) (Command, error) {
+	var cmd Command
+	var err error
+	if format == FormatJSON {
+		cmd, err = parseJSONCommand(message)
+	} else {
+		cmd, err = parseTextCommand(string(message))
+	}
+
+	var commandErr *CommandError
+	if err != nil && !errors.As(err, &commandErr) {
+		err = parseError(err)
+	}
+	return cmd, err
+}
+
+// parseJSONCommand decodes a JSON envelope. Unknown fields are ignored so
+// newer clients keep working with older servers.
+func parseJSONCommand(message []byte) (Command, error) {
+	var cmd Command
+	if err := json.Unmarshal(message, &cmd); err != nil {
+		return Command{}, fmt.Errorf("invalid JSON message: %w", err)
+	}
+
+	if cmd.Version != ProtocolVersion {
+		return cmd, unsupportedError(fmt.Errorf("unsupported protocol version %d, expected %d", cmd.Version, ProtocolVersion))
+	}
+	if cmd.Type == "" {
+		return cmd, errors.New("message has no type")
+	}
+	return cmd, nil
+}
+
+// parseTextCommand decodes a legacy text message
+func parseTextCommand(message string) (Command, error) {
+	cmd := Command{Version: ProtocolVersion}
+
+	prefix, arg, hasPrefix := strings.Cut(message, ":")
+	if !hasPrefix {
+		// Movement: "deltaX,deltaY"
+		cmd.Type = CommandMove
+		return cmd, parsePair(message, &cmd.DX, &cmd.DY)
+	}
+
+	switch prefix {
+	case "click":
+		cmd.Type = CommandClick
+		if arg == "double" {
+			cmd.Button, cmd.Double = "left", true
+		} else {
+			cmd.Button = arg
+		}
+	case "scroll":
+		cmd.Type = CommandScroll
+		return cmd, parsePair(arg, &cmd.DX, &cmd.DY)
+	case "key", "keydown", "keyup":
+		cmd.Type = prefix
+		cmd.Key = arg
+	case "type":
+		// The rest of the message is typed verbatim, colons included
+		cmd.Type = CommandType
+		cmd.Text = arg
+	case "config", "stabilize":
+		// Only the first '=' separates the key, "accel=power,exponent=2" has more
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			return cmd, fmt.Errorf("invalid %s command format, expected 'key=value'", prefix)
+		}
+		cmd.Type = prefix
+		cmd.Settings = map[string]json.RawMessage{key: json.RawMessage(strconv.Quote(value))}
+	case "query":
+		cmd.Type = CommandQuery
+		cmd.Query = arg
+	case "hello":
+		// "hello:keyboard,scroll"
+		cmd.Type = CommandHello
+		if arg != "" {
+			cmd.Features = strings.Split(arg, ",")
+		}
+	case "pair":
+		// "pair:123456" or "pair:123456,device name"
+		cmd.Type = CommandPair
+		cmd.PIN, cmd.Client, _ = strings.Cut(arg, ",")
+	case "auth":
+		cmd.Type = CommandAuth
+		cmd.Token = arg
+	case "control":
+		cmd.Type = CommandControl
+		cmd.Action = arg
+	default:
+		// Buttons: "leftbutton:down", "middlebutton:up", ...
+		if button := strings.TrimSuffix(prefix, "button"); button != prefix {
+			cmd.Type = CommandButton
+			cmd.Button, cmd.State = button, arg
+			return cmd, nil
+		}
+		return cmd, fmt.Errorf("invalid message format. Expected 'deltaX,deltaY', 'click:type', " +
+			"'<button>button:state', 'scroll:dx,dy', 'config:...', 'query:...', 'stabilize:...', " +
+			"'key:combo', 'keydown:key', 'keyup:key', 'type:text', 'hello:features', " +
+			"'pair:pin', 'auth:token' or 'control:action'")
+	}
+	return cmd, nil
+}
+
+// parsePair parses "x,y" into two numbers
+func parsePair(pair string, x, y *float64) error {
+	parts := strings.Split(pair, ",")
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid pair %q, expected 'x,y'", pair)
+	}
+
+	var err error
+	if *x, err = strconv.ParseFloat(parts[0], 64); err != nil || math.IsNaN(*x) || math.IsInf(*x, 0) {
+		return fmt.Errorf("invalid x value: %q", parts[0])
+	}
+	if *y, err = strconv.ParseFloat(parts[1], 64); err != nil || math.IsNaN(*y) || math.IsInf(*y, 0) {
+		return fmt.Errorf("invalid y value: %q", parts[1])
+	}
+	return nil
+}
+
+// DisplayInfo describes a display in replies
+type DisplayInfo struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// Reply types
+const (
+	ReplyHello    = "hello"
+	ReplyAck      = "ack"
+	ReplyError    = "error"
+	ReplyDisplays = "displays"
+	// ReplyPaired carries the device token issued by a pair command
+	ReplyPaired = "paired"
+	// ReplyAuthenticated answers a successful auth command
+	ReplyAuthenticated = "authenticated"
+	// ReplyControl tells the client its control state changed
+	ReplyControl = "control"
+)
+
+// Error codes, telling the client what went wrong
+const (
+	// ErrorParse means the message couldn't be decoded
+	ErrorParse = "parse"
+	// ErrorValidation means the message was decoded but asks for something
+	// invalid, like an unknown button, key or config setting
+	ErrorValidation = "validation"
+	// ErrorBackend means the command was valid but injecting it failed
+	ErrorBackend = "backend"
+	// ErrorUnsupported means the server can't do what the command asks,
+	// e.g. typing with a backend that has no keyboard
+	ErrorUnsupported = "unsupported"
+	// ErrorUnauthorized means the connection must pair or authenticate
+	// first, or the PIN or token it sent is wrong
+	ErrorUnauthorized = "unauthorized"
+	// ErrorControl means another session has control
+	ErrorControl = "control"
+)
+
+// CommandError is an error with the code reported to the client
+type CommandError struct {
+	Code string
+	Err  error
+}
+
+func (e *CommandError) Error() string { return e.Err.Error() }
+func (e *CommandError) Unwrap() error { return e.Err }
+
+// parseError marks err as a parse failure
+func parseError(err error) error {
+	return &CommandError{Code: ErrorParse, Err: err}
+}
+
+// validationError marks err as a validation failure
+func validationError(err error) error {
+	return &CommandError{Code: ErrorValidation, Err: err}
+}
+
+// unsupportedError marks err as a request the server can't serve
+func unsupportedError(err error) error {
+	return &CommandError{Code: ErrorUnsupported, Err: err}
+}
+
+// unauthorizedError marks err as a failed or missing authentication
+func unauthorizedError(err error) error {
+	return &CommandError{Code: ErrorUnauthorized, Err: err}
+}
+
+// errorCode returns the code of a CommandError, errors without a code
+// come from the backend
+func errorCode(err error) string {
+	var commandErr *CommandError
+	if errors.As(err, &commandErr) {
+		return commandErr.Code
+	}
+	return ErrorBackend
+}
+
+// StateInfo describes the server settings in hello replies
+type StateInfo struct {
+	Speed         float64 `json:"speed"`
+	Bounds        bool    `json:"bounds"`
+	Accel         string  `json:"accel"`
+	Stabilization bool    `json:"stabilization"`
+	// Confine is the index of the display the cursor is kept on, -1 for none
+	Confine  int           `json:"confine"`
+	Displays []DisplayInfo `json:"displays"`
+	// Control is the control policy, e.g. "first-wins"
+	Control string `json:"control"`
+}
+
+// LimitsInfo describes the limits the server enforces
+type LimitsInfo struct {
+	MaxMessageSize int `json:"max_message_size"`
+	MaxTextLength  int `json:"max_text_length"`
+}
+
+// CapabilitiesInfo describes what the server can do in hello replies
+type CapabilitiesInfo struct {
+	// Backend is the name of the active backend, e.g. "uinput"
+	Backend  string     `json:"backend"`
+	Features []string   `json:"features"`
+	Buttons  []string   `json:"buttons"`
+	Limits   LimitsInfo `json:"limits"`
+}
+
+// ControlInfo describes a change of the client's control state
+type ControlInfo struct {
+	// State is one of the Control* states
+	State string `json:"state"`
+	// Position is the client's place in line, counting from 1, when queued
+	Position int `json:"position,omitempty"`
+	// Requester names the device asking for control, when requested
+	Requester string `json:"requester,omitempty"`
+}
+
+// UDPInfo describes how a session sends movement datagrams
+type UDPInfo struct {
+	Port int `json:"port"`
+	// Token is the hex encoded session token starting every datagram
+	Token string `json:"token"`
+}
+
+// Reply is a message from the server to the client
+type Reply struct {
+	Version int    `json:"v"`
+	Type    string `json:"type"`
+	// ID echoes the ID of the command being answered
+	ID string `json:"id,omitempty"`
+
+	// Code and Message describe the failure of error replies
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+
+	// State and Capabilities are sent in hello replies
+	State        *StateInfo        `json:"state,omitempty"`
+	Capabilities *CapabilitiesInfo `json:"capabilities,omitempty"`
+	// Unsupported lists the features the client announced that the server
+	// doesn't offer, in hello replies
+	Unsupported []string `json:"unsupported,omitempty"`
+	// AuthRequired tells the client to pair or authenticate before sending
+	// input, in hello replies
+	AuthRequired bool `json:"auth_required,omitempty"`
+	// UDP tells the client where to send movement datagrams once it is
+	// authenticated, in hello, paired and authenticated replies when the
+	// UDP listener is running
+	UDP *UDPInfo `json:"udp,omitempty"`
+	// Token is the device token of paired replies
+	Token string `json:"token,omitempty"`
+	// Control is the new control state of control replies
+	Control *ControlInfo `json:"control,omitempty"`
+
+	Displays []DisplayInfo `json:"displays,omitempty"`
+}
+
+// errorReply reports a failed command
+func errorReply(id string, err error) Reply {
+	return Reply{
+		Version: ProtocolVersion,
+		Type:    ReplyError,
+		ID:      id,
+		Code:    errorCode(err),
+		Message: err.Error(),
+	}
+}
+
+// encodeReply encodes a reply in the connection's format. Text connections
+// get "hello:v=1;speed=1;...", "error:code:message",
+// "displays:x,y,width,height|...", "paired:token=...;udp=port:token" and
+// "authenticated:udp=port:token" and "control:state;position=1". Free text,
+// like messages and device names, is escaped with escapeText. Acks are only
+// sent to JSON connections, text commands have no id to acknowledge. A nil
+// result means nothing is sent.
+func encodeReply(format Format, reply Reply) ([]byte, error) {
+	if format == FormatJSON {
+		return json.Marshal(reply)
+	}
+
+	switch reply.Type {
+	case ReplyHello:
+		fields := []string{fmt.Sprintf("v=%d", reply.Version)}
+		if state := reply.State; state != nil {
+			fields = append(fields,
+				fmt.Sprintf("speed=%g", state.Speed),
+				fmt.Sprintf("bounds=%t", state.Bounds),
+				"accel="+state.Accel,
+				fmt.Sprintf("stabilization=%t", state.Stabilization),
+				fmt.Sprintf("confine=%d", state.Confine),
+				"displays="+formatDisplays(state.Displays),
+				"control="+state.Control,
+			)
+		}
+		if caps := reply.Capabilities; caps != nil {
+			fields = append(fields,
+				"backend="+caps.Backend,
+				"features="+strings.Join(caps.Features, ","),
+				"buttons="+strings.Join(caps.Buttons, ","),
+				fmt.Sprintf("max_message_size=%d", caps.Limits.MaxMessageSize),
+				fmt.Sprintf("max_text_length=%d", caps.Limits.MaxTextLength),
+			)
+		}
+		if len(reply.Unsupported) > 0 {
+			fields = append(fields, "unsupported="+strings.Join(reply.Unsupported, ","))
+		}
+		if reply.AuthRequired {
+			fields = append(fields, "auth=required")
+		}
+		if udp := reply.UDP; udp != nil {
+			fields = append(fields, fmt.Sprintf("udp=%d:%s", udp.Port, udp.Token))
+		}
+		return []byte("hello:" + strings.Join(fields, ";")), nil
+	case ReplyPaired, ReplyAuthenticated:
+		var fields []string
+		if reply.Token != "" {
+			fields = append(fields, "token="+reply.Token)
+		}
+		if udp := reply.UDP; udp != nil {
+			fields = append(fields, fmt.Sprintf("udp=%d:%s", udp.Port, udp.Token))
+		}
+		return []byte(reply.Type + ":" + strings.Join(fields, ";")), nil
+	case ReplyError:
+		return []byte("error:" + reply.Code + ":" + escapeText(reply.Message)), nil
+	case ReplyDisplays:
+		return []byte("displays:" + formatDisplays(reply.Displays)), nil
+	case ReplyControl:
+		fields := []string{reply.Control.State}
+		if reply.Control.Position > 0 {
+			fields = append(fields, fmt.Sprintf("position=%d", reply.Control.Position))
+		}
+		if reply.Control.Requester != "" {
+			fields = append(fields, "requester="+escapeText(reply.Control.Requester))
+		}
+		return []byte("control:" + strings.Join(fields, ";")), nil
+	}
+	return nil, nil
+}
+
+// textEscaper percent-encodes the characters separating the fields of text
+// replies, and the percent sign itself
+var textEscaper = strings.NewReplacer("%", "%25", ";", "%3B", "=", "%3D", "|", "%7C", "\r", "%0D", "\n", "%0A")
+
+// escapeText escapes free text for a text reply, so it can't be mistaken
+// for a separator. Clients decode it like a URL component.
+func escapeText(text string) string {
+	return textEscaper.Replace(text)
+}
+
+// formatDisplays formats displays as "x,y,width,height|..." for text
+// replies, '|' keeps them apart from the fields of a hello
+func formatDisplays(displays []DisplayInfo) string {
+	rects := make([]string, len(displays))
+	for i, display := range displays {
+		rects[i] = fmt.Sprintf("%d,%d,%d,%d", display.X, display.Y, display.Width, display.Height)
+	}
+	return strings.Join(rects, "|")
+}
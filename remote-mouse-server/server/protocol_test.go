@@ -0,0 +1,65 @@
+package server
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestEncodeTextReply(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply Reply
+		want  string
+	}{
+		{
+			name: "hello with two displays",
+			reply: Reply{Version: 1, Type: ReplyHello, State: &StateInfo{
+				Speed: 1, Accel: "linear", Confine: -1, Control: "first-wins",
+				Displays: []DisplayInfo{{0, 0, 1920, 1080}, {1920, 0, 2560, 1440}},
+			}},
+			want: "hello:v=1;speed=1;bounds=false;accel=linear;stabilization=false;confine=-1;displays=0,0,1920,1080|1920,0,2560,1440;control=first-wins",
+		},
+		{
+			name:  "displays",
+			reply: Reply{Type: ReplyDisplays, Displays: []DisplayInfo{{0, 0, 1920, 1080}, {1920, -200, 2560, 1440}}},
+			want:  "displays:0,0,1920,1080|1920,-200,2560,1440",
+		},
+		{
+			name:  "requester",
+			reply: Reply{Type: ReplyControl, Control: &ControlInfo{State: ControlRequested, Requester: "Bob's phone;x=1|100%"}},
+			want:  "control:requested;requester=Bob's phone%3Bx%3D1%7C100%25",
+		},
+		{
+			name:  "error message",
+			reply: errorReply("", validationError(errors.New("bad value: \"a;b=c\"\nagain"))),
+			want:  "error:validation:bad value: \"a%3Bb%3Dc\"%0Aagain",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			message, err := encodeReply(FormatText, test.reply)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(message) != test.want {
+				t.Errorf("encoded\n%s\nwant\n%s", message, test.want)
+			}
+		})
+	}
+}
+
+func TestEscapeText(t *testing.T) {
+	for _, text := range []string{"Pixel 8", "a;b=c|d", "100% done", "line\r\nbreak", "é ✓"} {
+		escaped := escapeText(text)
+		if strings.ContainsAny(escaped, ";=|\r\n") {
+			t.Errorf("%q escaped as %q, which contains a separator", text, escaped)
+		}
+		// Clients decode it like a URL component
+		if decoded, err := url.PathUnescape(escaped); err != nil || decoded != text {
+			t.Errorf("%q escaped as %q decodes to %q, %v", text, escaped, decoded, err)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package server
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/tommyalmeida/remote-mouse/keyboard"
+	"github.com/tommyalmeida/remote-mouse/mouse"
+)
+
+// Server is a long-lived remote mouse server. It owns one mouse and one
+// keyboard controller shared by every connection, so settings a client
+// changes stay in effect for the others and for later connections, and
+// it keeps track of the open sessions.
+type Server struct {
+	config    *WebSocketConfig
+	mouseCtrl *mouse.Controller
+	keyCtrl   *keyboard.Controller
+	caps      capabilities
+	control   *arbiter
+	upgrader  websocket.Upgrader
+
+	// stabilization holds the latest stabilization settings, kept while
+	// stabilization is disabled
+	stabilization   mouse.StabilizationOptions
+	stabilizationMu sync.Mutex
+
+	// allowlist and idleTimeout start as in config and change with
+	// Reconfigure
+	allowlist   atomic.Pointer[Allowlist]
+	idleTimeout atomic.Int64
+
+	// sessions are the open connections, closed on shutdown
+	sessions map[*session]bool
+	closing  bool
+	// udp is the UDP listener, nil when UDP is disabled
+	udp        *UDPListener
+	wg         sync.WaitGroup
+	sessionsMu sync.Mutex
+}
+
+// NewServer opens the backend and creates the controllers shared by every
+// connection. A nil config uses DefaultWebSocketConfig.
+func NewServer(config *WebSocketConfig) *Server {
+	if config == nil {
+		config = DefaultWebSocketConfig()
+	}
+
+	mouseCtrl := mouse.NewController(config.MouseConfig, config.Backend)
+
+	stabilization := mouseCtrl.Stabilization()
+	if stabilization == nil {
+		stabilization = mouse.DefaultStabilizationOptions()
+	}
+
+	s := &Server{
+		config:    config,
+		mouseCtrl: mouseCtrl,
+		// The keyboard injects through the same backend as the mouse
+		keyCtrl: keyboard.NewController(config.KeyboardConfig, mouseCtrl.Backend()),
+		caps:    newCapabilities(mouseCtrl.Backend()),
+		control: newArbiter(config.ControlPolicy),
+		upgrader: websocket.Upgrader{
+			// Origins are checked against the Allowlist before upgrading
+			CheckOrigin: func(r *http.Request) bool {
+				return true
+			},
+		},
+		stabilization: *stabilization,
+		sessions:      make(map[*session]bool),
+	}
+
+	allowlist := config.Allowlist
+	s.allowlist.Store(&allowlist)
+	s.idleTimeout.Store(int64(config.IdleTimeout))
+	s.control.setIdleTimeout(config.IdleTimeout)
+	return s
+}
+
+// Reconfiguration changes settings of a running server, nil fields are
+// left unchanged
+type Reconfiguration struct {
+	SpeedFactor   *float64
+	EnforceBounds *bool
+	// Acceleration replaces the acceleration profile, a LinearProfile
+	// disables acceleration
+	Acceleration  mouse.AccelProfile
+	Stabilization StabilizationPatch
+	Allowlist     *Allowlist
+	IdleTimeout   *time.Duration
+}
+
+// StabilizationPatch changes some of the stabilization settings, nil
+// fields are left unchanged. The settings are kept while stabilization is
+// disabled.
+type StabilizationPatch struct {
+	Enabled        *bool
+	DeadZone       *int
+	SmoothingLevel *float64
+	JiggleFilter   *bool
+	AntiDrift      *bool
+}
+
+// empty reports whether the patch changes nothing
+func (p StabilizationPatch) empty() bool {
+	return p == StabilizationPatch{}
+}
+
+// apply changes options and enabled as set in the patch
+func (p StabilizationPatch) apply(options *mouse.StabilizationOptions, enabled *bool) {
+	if p.Enabled != nil {
+		*enabled = *p.Enabled
+	}
+	if p.DeadZone != nil {
+		options.DeadZone = *p.DeadZone
+	}
+	if p.SmoothingLevel != nil {
+		options.SmoothingLevel = *p.SmoothingLevel
+	}
+	if p.JiggleFilter != nil {
+		options.JiggleFilter = *p.JiggleFilter
+	}
+	if p.AntiDrift != nil {
+		options.AntiDrift = *p.AntiDrift
+	}
+}
+
+// Reconfigure applies the settings set in changes to the running server,
+// keeping every connection open and the settings clients changed
+// otherwise. Nothing changes if a setting is out of range.
+func (s *Server) Reconfigure(changes Reconfiguration) error {
+	s.stabilizationMu.Lock()
+	defer s.stabilizationMu.Unlock()
+
+	patch := mouse.ConfigPatch{
+		SpeedFactor:   changes.SpeedFactor,
+		EnforceBounds: changes.EnforceBounds,
+		Acceleration:  changes.Acceleration,
+	}
+
+	// Settings changed while stabilization is disabled apply once enabled
+	stabilization := s.stabilization
+	if !changes.Stabilization.empty() {
+		enabled := s.mouseCtrl.Stabilization() != nil
+		changes.Stabilization.apply(&stabilization, &enabled)
+		if err := stabilization.Validate(); err != nil {
+			return err
+		}
+
+		if enabled {
+			patch.Stabilization = &stabilization
+		} else {
+			patch.DisableStabilization = true
+		}
+	}
+
+	if err := s.mouseCtrl.UpdateConfig(patch); err != nil {
+		return err
+	}
+	s.stabilization = stabilization
+
+	if changes.Allowlist != nil {
+		allowlist := *changes.Allowlist
+		s.allowlist.Store(&allowlist)
+	}
+	if changes.IdleTimeout != nil {
+		s.idleTimeout.Store(int64(*changes.IdleTimeout))
+		s.control.setIdleTimeout(*changes.IdleTimeout)
+	}
+	return nil
+}
+
+// WebSocketHandler is the former name of Server
+type WebSocketHandler = Server
+
+// NewWebSocketHandler is the former name of NewServer
+func NewWebSocketHandler(config *WebSocketConfig) *Server {
+	return NewServer(config)
+}
+
+var (
+	// defaultServer serves WSHandler, created on its first connection
+	defaultServer     atomic.Pointer[Server]
+	defaultServerOnce sync.Once
+)
+
+// WSHandler serves a connection with the default server, which uses the
+// default config, without pairing
+func WSHandler(w http.ResponseWriter, r *http.Request) {
+	defaultServerOnce.Do(func() {
+		defaultServer.Store(NewServer(DefaultWebSocketConfig()))
+	})
+	defaultServer.Load().ServeHTTP(w, r)
+}
+
+// GetActiveConnectionCount returns the number of connections to the
+// default server of WSHandler
+func GetActiveConnectionCount() int {
+	if server := defaultServer.Load(); server != nil {
+		return server.ActiveConnections()
+	}
+	return 0
+}
+
+// ActiveConnections returns the number of open connections
+func (s *Server) ActiveConnections() int {
+	s.sessionsMu.Lock()
+	defer s.sessionsMu.Unlock()
+
+	return len(s.sessions)
+}
+
+// track registers a new session, it fails once the server is closed
+func (s *Server) track(session *session) bool {
+	s.sessionsMu.Lock()
+	defer s.sessionsMu.Unlock()
+
+	if s.closing {
+		return false
+	}
+	s.sessions[session] = true
+	s.wg.Add(1)
+	return true
+}
+
+// untrack forgets a session that ended
+func (s *Server) untrack(session *session) {
+	s.sessionsMu.Lock()
+	delete(s.sessions, session)
+	s.sessionsMu.Unlock()
+
+	s.wg.Done()
+}
+
+// isClosing reports whether Close was called
+func (s *Server) isClosing() bool {
+	s.sessionsMu.Lock()
+	defer s.sessionsMu.Unlock()
+
+	return s.closing
+}
+
+// udpListener returns the UDP listener, nil when UDP is disabled
+func (s *Server) udpListener() *UDPListener {
+	s.sessionsMu.Lock()
+	defer s.sessionsMu.Unlock()
+
+	return s.udp
+}
+
+// Close stops the UDP listener, disconnects every client, releasing what
+// they hold, and waits for their sessions to end. New connections are
+// refused afterwards.
+func (s *Server) Close() error {
+	s.sessionsMu.Lock()
+	s.closing = true
+	udp := s.udp
+	for session := range s.sessions {
+		session.conn.Close()
+	}
+	s.sessionsMu.Unlock()
+
+	var err error
+	if udp != nil {
+		err = udp.Close()
+	}
+	s.wg.Wait()
+	return err
+}
@@ -0,0 +1,189 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/tommyalmeida/remote-mouse/mouse/native"
+)
+
+func TestReconfigureKeepsClientSettings(t *testing.T) {
+	srv, _, url := newTestServer(t)
+	conn := dial(t, url)
+
+	for _, message := range []string{"config:speed=3", "stabilize:deadzone=4", "stabilize:enable=true"} {
+		conn.WriteMessage(websocket.TextMessage, []byte(message))
+	}
+	hangUp(t, srv, conn)
+
+	bounds, smoothing := false, 0.25
+	err := srv.Reconfigure(Reconfiguration{
+		EnforceBounds: &bounds,
+		Stabilization: StabilizationPatch{SmoothingLevel: &smoothing},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state := srv.mouseCtrl.State()
+	if state.SpeedFactor != 3 || state.EnforceBounds || !state.Stabilization {
+		t.Errorf("speed %g, bounds %v, stabilization %v, want 3, false, true", state.SpeedFactor, state.EnforceBounds, state.Stabilization)
+	}
+	if options := srv.mouseCtrl.Stabilization(); options.DeadZone != 4 || options.SmoothingLevel != 0.25 {
+		t.Errorf("dead zone %d, smoothing %g, want 4, 0.25", options.DeadZone, options.SmoothingLevel)
+	}
+
+	// A setting out of range changes nothing
+	speed := -1.0
+	if err := srv.Reconfigure(Reconfiguration{SpeedFactor: &speed, EnforceBounds: &bounds}); err == nil {
+		t.Error("negative speed accepted")
+	}
+	if state := srv.mouseCtrl.State(); state.SpeedFactor != 3 {
+		t.Errorf("speed %g after a failed reconfiguration, want 3", state.SpeedFactor)
+	}
+}
+
+// TestConcurrentSessions is meant for go test -race. Sessions take turns
+// changing the shared settings, the one in control at the time, while
+// Reconfigure changes them too and every session moves over UDP.
+func TestConcurrentSessions(t *testing.T) {
+	const sessions, rounds = 4, 50
+
+	config := testConfig()
+	config.Backend = native.NewVirtual(1920, 1080)
+	config.ControlPolicy = ControlLastWins
+	srv, url := serveConfig(t, config)
+	listener, err := srv.ListenUDP("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go listener.Serve()
+
+	done := make(chan struct{})
+	var background sync.WaitGroup
+
+	// Movement datagrams reach session.stabilizer from the listener, next
+	// to the session's own moves
+	conns := make([]*websocket.Conn, sessions)
+	for i := range conns {
+		conns[i] = dial(t, url)
+		port, token := udpInfo(t, conns[i])
+		udp, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer udp.Close()
+
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			for sequence := uint32(1); ; sequence++ {
+				select {
+				case <-done:
+					return
+				case <-time.After(time.Millisecond):
+				}
+				udp.Write(datagram(token, sequence, 1, -1))
+			}
+		}()
+	}
+
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		// Reloads are seconds apart, without a pause the writes would
+		// starve every move
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			case <-time.After(100 * time.Microsecond):
+			}
+
+			speed, smoothing, enabled := float64(1+i%3), float64(i%10)/10, i%2 == 0
+			err := srv.Reconfigure(Reconfiguration{
+				SpeedFactor:   &speed,
+				Stabilization: StabilizationPatch{Enabled: &enabled, SmoothingLevel: &smoothing},
+			})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	var (
+		wg   sync.WaitGroup
+		turn sync.Mutex
+	)
+	for i, conn := range conns {
+		wg.Add(1)
+		go func(i int, conn *websocket.Conn) {
+			defer wg.Done()
+			for round := 0; round < rounds; round++ {
+				turn.Lock()
+				err := settingsRound(conn, []string{
+					fmt.Sprintf(`{"v":1,"type":"config","id":"speed","settings":{"speed":%d}}`, 1+(i+round)%4),
+					fmt.Sprintf(`{"v":1,"type":"stabilize","id":"stabilize","settings":{"deadzone":%d,"enable":%v}}`, round%4, round%3 != 0),
+					`{"v":1,"type":"move","id":"move","dx":3,"dy":-2}`,
+				})
+				turn.Unlock()
+				if err != nil {
+					t.Errorf("session %d, round %d: %v", i, round, err)
+					return
+				}
+			}
+		}(i, conn)
+	}
+	wg.Wait()
+	close(done)
+	background.Wait()
+
+	for _, conn := range conns[1:] {
+		conn.Close()
+	}
+	hangUp(t, srv, conns[0])
+
+	if state := srv.mouseCtrl.State(); state.SpeedFactor < 1 || state.SpeedFactor > 4 {
+		t.Errorf("speed %g, want one that was set", state.SpeedFactor)
+	}
+}
+
+// settingsRound takes control and sends JSON messages, every one of them
+// must be acknowledged
+func settingsRound(conn *websocket.Conn, messages []string) error {
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"v":1,"type":"control","action":"request"}`))
+
+	granted := false
+	pending := len(messages)
+	for pending > 0 {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		var reply Reply
+		if err := json.Unmarshal(message, &reply); err != nil {
+			// The text greeting
+			continue
+		}
+
+		switch {
+		case reply.Type == ReplyError:
+			return fmt.Errorf("error reply %s", message)
+		case reply.Type == ReplyControl && reply.Control.State == ControlGranted && !granted:
+			granted = true
+			for _, message := range messages {
+				conn.WriteMessage(websocket.TextMessage, []byte(message))
+			}
+		case reply.Type == ReplyAck && granted:
+			pending--
+		}
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package server
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/tommyalmeida/remote-mouse/mouse"
+)
+
+const (
+	// writeTimeout is how long a reply may take to reach the client before
+	// the connection is considered dead
+	writeTimeout = 5 * time.Second
+	// outgoingQueueSize is how many replies can wait for the writer
+	outgoingQueueSize = 32
+)
+
+// session is the state of one client connection.
+// The read loop owns it, replies are written by a separate goroutine so a
+// slow client never delays input handling. Other sessions may notify it,
+// e.g. to hand over control.
+type session struct {
+	conn       *websocket.Conn
+	remoteAddr string
+	// format is detected from the first message. The read loop sets it
+	// with setFormat, other goroutines read it with mutex held.
+	format Format
+	// verbose enables logging of failed writes
+	verbose bool
+	// authenticated is set once input is accepted, device names the
+	// paired device
+	authenticated bool
+	device        string
+	// udp is announced to authenticated clients, nil when UDP is disabled.
+	// udpToken authenticates the session's datagrams.
+	udp      *UDPInfo
+	udpToken udpToken
+	// held are the buttons and keys the client pressed and hasn't released
+	held heldInput
+	// stabilizer is the stabilization filter state of the client's moves
+	stabilizer *mouse.Stabilizer
+	// inputRejected is set once the client was told it doesn't have
+	// control, and cleared when its control state changes
+	inputRejected atomic.Bool
+	// left is set once the session left the arbiter, guarded by its mutex
+	left bool
+
+	outgoing chan []byte
+	// done is closed when the writer stops
+	done chan struct{}
+	// closed is set by close, sends after it are dropped
+	closed bool
+	mutex  sync.Mutex
+}
+
+// newSession starts the writer of a new connection
+func newSession(conn *websocket.Conn, remoteAddr string, verbose bool) *session {
+	s := &session{
+		conn:       conn,
+		remoteAddr: remoteAddr,
+		verbose:    verbose,
+		stabilizer: mouse.NewStabilizer(),
+		outgoing:   make(chan []byte, outgoingQueueSize),
+		done:       make(chan struct{}),
+	}
+	go s.writeLoop()
+	return s
+}
+
+// writeLoop writes queued replies until the session is closed
+func (s *session) writeLoop() {
+	defer close(s.done)
+
+	for message := range s.outgoing {
+		s.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		if err := s.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+			if s.verbose {
+				fmt.Printf("Error writing to %s: %v\n", s.remoteAddr, err)
+			}
+			// Unblock the read loop, the connection is unusable
+			s.conn.Close()
+			for range s.outgoing {
+			}
+			return
+		}
+	}
+}
+
+// setFormat sets the format replies are sent in
+func (s *session) setFormat(format Format) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.format = format
+}
+
+// send queues a reply in the session's format, waiting for room in the
+// queue. Only the read loop may wait, other goroutines use notify.
+func (s *session) send(reply Reply) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if message := s.encode(reply); message != nil {
+		select {
+		case s.outgoing <- message:
+		case <-s.done:
+		}
+	}
+}
+
+// notify queues a reply from another goroutine without waiting. A client
+// too slow to take it is disconnected rather than left with a missing
+// notice, and rather than stalling the sender.
+func (s *session) notify(reply Reply) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if message := s.encode(reply); message != nil {
+		select {
+		case s.outgoing <- message:
+		default:
+			if s.verbose {
+				fmt.Printf("Disconnecting %s, it doesn't keep up with replies\n", s.remoteAddr)
+			}
+			// The read loop ends and cleans up
+			s.conn.Close()
+		}
+	}
+}
+
+// encode encodes a reply in the session's format, nil when nothing is
+// sent. Must be called with mutex held.
+func (s *session) encode(reply Reply) []byte {
+	if s.closed {
+		return nil
+	}
+
+	message, err := encodeReply(s.format, reply)
+	if err != nil {
+		if s.verbose {
+			fmt.Println("Error encoding reply:", err)
+		}
+		return nil
+	}
+	return message
+}
+
+// name identifies the session in logs and control requests
+func (s *session) name() string {
+	if s.device != "" {
+		return s.device
+	}
+	return s.remoteAddr
+}
+
+// close stops the writer once every queued reply has been written.
+// Must be called by the read loop, after its last send.
+func (s *session) close() {
+	s.mutex.Lock()
+	s.closed = true
+	close(s.outgoing)
+	s.mutex.Unlock()
+
+	<-s.done
+}
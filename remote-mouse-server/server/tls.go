@@ -0,0 +1,134 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// certificateLifetime is how long generated certificates are valid
+const certificateLifetime = 10 * 365 * 24 * time.Hour
+
+// DefaultCertificatePaths returns the files a generated certificate and its
+// key are stored in: remote-mouse/cert.pem and remote-mouse/key.pem in the
+// user's config directory
+func DefaultCertificatePaths() (certFile, keyFile string, err error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", "", err
+	}
+	dir = filepath.Join(dir, "remote-mouse")
+	return filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"), nil
+}
+
+// LoadOrCreateCertificate loads the certificate and key from the given
+// files, generating a self-signed certificate on first run.
+// created reports whether a new certificate was generated.
+func LoadOrCreateCertificate(certFile, keyFile string) (cert tls.Certificate, created bool, err error) {
+	cert, err = tls.LoadX509KeyPair(certFile, keyFile)
+	if err == nil {
+		return cert, false, nil
+	}
+	// Never overwrite a certificate that exists but can't be loaded
+	if _, statErr := os.Stat(certFile); !errors.Is(statErr, os.ErrNotExist) {
+		return tls.Certificate{}, false, err
+	}
+
+	certPEM, keyPEM, err := generateCertificate()
+	if err != nil {
+		return tls.Certificate{}, false, fmt.Errorf("failed to generate certificate: %w", err)
+	}
+	if err := writeFile(keyFile, keyPEM, 0o600); err != nil {
+		return tls.Certificate{}, false, err
+	}
+	if err := writeFile(certFile, certPEM, 0o644); err != nil {
+		return tls.Certificate{}, false, err
+	}
+
+	cert, err = tls.X509KeyPair(certPEM, keyPEM)
+	return cert, true, err
+}
+
+// CertificateFingerprint returns the SHA-256 fingerprint of a certificate,
+// formatted as colon separated hex bytes. Clients pin it when pairing.
+func CertificateFingerprint(cert tls.Certificate) string {
+	if len(cert.Certificate) == 0 {
+		return ""
+	}
+
+	sum := sha256.Sum256(cert.Certificate[0])
+	hexBytes := make([]string, len(sum))
+	for i, b := range sum {
+		hexBytes[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(hexBytes, ":")
+}
+
+// generateCertificate creates a self-signed ECDSA P-256 certificate valid
+// for localhost, the host name and every address of the machine
+func generateCertificate() (certPEM, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "Remote Mouse"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(certificateLifetime),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+	}
+	if hostname, err := os.Hostname(); err == nil && hostname != "localhost" {
+		template.DNSNames = append(template.DNSNames, hostname)
+	}
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok {
+				template.IPAddresses = append(template.IPAddresses, ipNet.IP)
+			}
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
+
+// writeFile writes data to path, creating its directory
+func writeFile(path string, data []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, perm)
+}
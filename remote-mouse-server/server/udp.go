@@ -0,0 +1,181 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"sync"
+)
+
+const (
+	// UDPTokenSize is the size of the session token starting every datagram
+	UDPTokenSize = 16
+	// UDPDatagramSize is the size of a datagram: the session token followed
+	// by a binary frame
+	UDPDatagramSize = UDPTokenSize + FrameSize
+)
+
+// udpToken identifies the WebSocket session a datagram belongs to
+type udpToken [UDPTokenSize]byte
+
+// udpSession routes datagrams to the WebSocket session they belong to
+type udpSession struct {
+	session *session
+	// addr is the address of the WebSocket client, datagrams from anywhere
+	// else are dropped
+	addr netip.Addr
+
+	// received is set once a datagram was accepted, sequence is its
+	// sequence number
+	received bool
+	sequence uint32
+}
+
+// UDPListener receives movement datagrams for the WebSocket sessions of a
+// Server.
+//
+// UDP avoids the head-of-line blocking of TCP: a lost datagram only loses
+// its own movement instead of stalling every later one. Each WebSocket
+// session is given a random token once authenticated, datagrams must start
+// with it and come from the session's address. Datagrams older than the
+// last accepted one are dropped, so the cursor never jumps back.
+// Only move and scroll frames are accepted, buttons, keys and settings stay
+// on the reliable WebSocket.
+type UDPListener struct {
+	server *Server
+	conn   *net.UDPConn
+
+	// sessions maps tokens to the sessions they were issued to
+	sessions map[udpToken]*udpSession
+	mutex    sync.Mutex
+}
+
+// ListenUDP starts listening for datagrams on address, e.g. ":8081".
+// A server has at most one listener, it is closed with the server.
+func (s *Server) ListenUDP(address string) (*UDPListener, error) {
+	addr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s.sessionsMu.Lock()
+	defer s.sessionsMu.Unlock()
+
+	if s.udp != nil {
+		conn.Close()
+		return nil, errors.New("the server already has a UDP listener")
+	}
+	s.udp = &UDPListener{server: s, conn: conn, sessions: make(map[udpToken]*udpSession)}
+	return s.udp, nil
+}
+
+// Port returns the port the listener is bound to
+func (l *UDPListener) Port() int {
+	return l.conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+// Close stops the listener, sessions keep working over WebSocket only
+func (l *UDPListener) Close() error {
+	l.server.sessionsMu.Lock()
+	if l.server.udp == l {
+		l.server.udp = nil
+	}
+	l.server.sessionsMu.Unlock()
+
+	return l.conn.Close()
+}
+
+// Serve handles datagrams until the listener is closed
+func (l *UDPListener) Serve() error {
+	// One spare byte detects datagrams that are too long
+	buf := make([]byte, UDPDatagramSize+1)
+	var (
+		token udpToken
+		frame Frame
+	)
+	server := l.server
+
+	for {
+		n, from, err := l.conn.ReadFromUDPAddrPort(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		if n != UDPDatagramSize {
+			continue
+		}
+
+		copy(token[:], buf)
+		if err := DecodeFrame(buf[UDPTokenSize:n], &frame); err != nil {
+			continue
+		}
+		if frame.Type != FrameMove && frame.Type != FrameScroll {
+			continue
+		}
+
+		session, ok := l.accept(token, from.Addr(), frame.Sequence)
+		if !ok || !server.control.acquire(session) {
+			continue
+		}
+		server.watchHeld(session)
+		if err := server.executeFrame(session, &frame); err != nil && server.config.Verbose {
+			fmt.Printf("Error handling datagram from %s: %v\n", from, err)
+		}
+	}
+}
+
+// accept returns the session a datagram belongs to, or false if the
+// datagram isn't authenticated or is older than the last accepted one
+func (l *UDPListener) accept(token udpToken, from netip.Addr, sequence uint32) (*session, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	udp, ok := l.sessions[token]
+	if !ok || udp.addr != from.Unmap() {
+		return nil, false
+	}
+	// Sequence numbers wrap around, a datagram is newer if it is less than
+	// half the range ahead
+	if udp.received && int32(sequence-udp.sequence) <= 0 {
+		return nil, false
+	}
+
+	udp.received = true
+	udp.sequence = sequence
+	return udp.session, true
+}
+
+// register issues a token for an authenticated WebSocket session
+func (l *UDPListener) register(s *session) (*UDPInfo, udpToken, error) {
+	var token udpToken
+
+	addrPort, err := netip.ParseAddrPort(s.remoteAddr)
+	if err != nil {
+		return nil, token, err
+	}
+	if _, err := rand.Read(token[:]); err != nil {
+		return nil, token, err
+	}
+
+	l.mutex.Lock()
+	l.sessions[token] = &udpSession{session: s, addr: addrPort.Addr().Unmap()}
+	l.mutex.Unlock()
+
+	return &UDPInfo{Port: l.Port(), Token: hex.EncodeToString(token[:])}, token, nil
+}
+
+// unregister revokes the token of a closed session
+func (l *UDPListener) unregister(token udpToken) {
+	l.mutex.Lock()
+	delete(l.sessions, token)
+	l.mutex.Unlock()
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"encoding/hex"
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestUDPAccept(t *testing.T) {
+	var token, otherToken udpToken
+	copy(token[:], "0123456789abcdef")
+	copy(otherToken[:], "fedcba9876543210")
+	addr := netip.MustParseAddr("192.168.1.20")
+
+	// Datagrams are accepted in order, each depends on the ones before
+	datagrams := []struct {
+		name     string
+		token    udpToken
+		from     string
+		sequence uint32
+		want     bool
+	}{
+		{name: "wrong token", token: otherToken, from: "192.168.1.20", sequence: 1},
+		{name: "wrong address", token: token, from: "192.168.1.21", sequence: 1},
+		{name: "first", token: token, from: "192.168.1.20", sequence: 10, want: true},
+		{name: "replayed", token: token, from: "192.168.1.20", sequence: 10},
+		{name: "out of order", token: token, from: "192.168.1.20", sequence: 9},
+		{name: "next", token: token, from: "192.168.1.20", sequence: 11, want: true},
+		{name: "skipping lost ones", token: token, from: "192.168.1.20", sequence: 15, want: true},
+		{name: "ipv4-mapped address", token: token, from: "::ffff:192.168.1.20", sequence: 16, want: true},
+		{name: "less than half the range ahead", token: token, from: "192.168.1.20", sequence: 0x80000000, want: true},
+		{name: "before wrapping", token: token, from: "192.168.1.20", sequence: 0xfffffffe, want: true},
+		{name: "last", token: token, from: "192.168.1.20", sequence: 0xffffffff, want: true},
+		{name: "wrapped", token: token, from: "192.168.1.20", sequence: 0, want: true},
+		{name: "stale after wrapping", token: token, from: "192.168.1.20", sequence: 0xffffffff},
+		{name: "after wrapping", token: token, from: "192.168.1.20", sequence: 1, want: true},
+		{name: "half the range ahead", token: token, from: "192.168.1.20", sequence: 0x80000001},
+	}
+
+	session := testSession("192.168.1.20:50000")
+	listener := &UDPListener{sessions: map[udpToken]*udpSession{
+		token: {session: session, addr: addr},
+	}}
+
+	for _, datagram := range datagrams {
+		got, ok := listener.accept(datagram.token, netip.MustParseAddr(datagram.from), datagram.sequence)
+		if ok != datagram.want || (ok && got != session) {
+			t.Errorf("%s: accepted %v, want %v", datagram.name, ok, datagram.want)
+		}
+	}
+}
+
+// udpInfo returns the UDP port and token of the text greeting
+func udpInfo(t *testing.T, conn *websocket.Conn) (int, udpToken) {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, message, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range strings.Split(string(message), ";") {
+		if value, ok := strings.CutPrefix(field, "udp="); ok {
+			var port int
+			var token udpToken
+			portText, tokenText, _ := strings.Cut(value, ":")
+			if _, err := hex.Decode(token[:], []byte(tokenText)); err != nil {
+				t.Fatal(err)
+			}
+			if port, err = net.LookupPort("udp", portText); err != nil {
+				t.Fatal(err)
+			}
+			return port, token
+		}
+	}
+	t.Fatalf("greeting %s has no udp field", message)
+	return 0, udpToken{}
+}
+
+// datagram encodes a movement datagram
+func datagram(token udpToken, sequence uint32, dx, dy float32) []byte {
+	data := make([]byte, UDPDatagramSize)
+	copy(data, token[:])
+	EncodeFrame(data[UDPTokenSize:], &Frame{Type: FrameMove, Sequence: sequence, DX: dx, DY: dy})
+	return data
+}
+
+func TestUDPMoves(t *testing.T) {
+	srv, virtual, url := newTestServer(t)
+	listener, err := srv.ListenUDP("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go listener.Serve()
+
+	conn := dial(t, url)
+	port, token := udpInfo(t, conn)
+	udp, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer udp.Close()
+
+	wrongToken := token
+	wrongToken[0]++
+	for _, data := range [][]byte{
+		datagram(token, 1, 10, 0),
+		datagram(wrongToken, 2, 100, 0),
+		datagram(token, 1, 100, 0),
+		datagram(token, 0, 100, 0),
+		datagram(token, 2, 0, 1)[:UDPDatagramSize-1],
+		datagram(token, 3, 0, 5),
+	} {
+		if _, err := udp.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Datagrams are handled in order, so once the last one moved the
+	// cursor the others were dropped
+	want := "move 970,540\nmove 970,545"
+	var got string
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		var events []string
+		for _, event := range virtual.Events() {
+			events = append(events, event.String())
+		}
+		if got = strings.Join(events, "\n"); len(events) >= 2 {
+			break
+		}
+	}
+	if got != want {
+		t.Fatalf("events:\n%s\nwant:\n%s", got, want)
+	}
+
+	// The token is revoked with the session
+	hangUp(t, srv, conn)
+	udp.Write(datagram(token, 4, 10, 0))
+	time.Sleep(20 * time.Millisecond)
+	if events := virtual.Events(); len(events) != 2 {
+		t.Errorf("%d events after the session ended, want 2", len(events))
+	}
+	if !srv.control.acquire(testSession("next")) {
+		t.Error("control is stuck with the session that ended")
+	}
+}
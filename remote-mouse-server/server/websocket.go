@@ -1,72 +1,60 @@
 package server
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
-	"sync"
+	"unicode/utf8"
+	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/tommyalmeida/remote-mouse/keyboard"
 	"github.com/tommyalmeida/remote-mouse/mouse"
 )
 
 type WebSocketConfig struct {
 	MouseConfig *mouse.Config
+	KeyboardConfig *keyboard.Config
+	// Backend injects the events, nil selects mouse.DefaultBackend
+	Backend mouse.Backend
+	// Pairing authenticates connections, nil accepts every connection,
+	// which is only safe on trusted networks
+	Pairing *Pairing
+	// Allowlist restricts the origins and networks connections come from
+	Allowlist Allowlist
+	// ControlPolicy decides who gets control when several clients want it
+	ControlPolicy ControlPolicy
+	// IdleTimeout releases the buttons and keys a client holds once it
+	// sent nothing for this long, and its control of the cursor once it
+	// sent no input for this long. 0 only releases them on disconnect.
+	IdleTimeout time.Duration
 	Verbose bool
 }
 
 func DefaultWebSocketConfig() *WebSocketConfig {
 	return &WebSocketConfig{
-		MouseConfig: mouse.DefaultConfig(),
-		Verbose:     true,
+		MouseConfig:    mouse.DefaultConfig(),
+		KeyboardConfig: keyboard.DefaultConfig(),
+		IdleTimeout:    30 * time.Second,
+		Verbose:        true,
 	}
 }
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true
-	},
-}
-
-var (
-	// activeConnections keeps track of all active WebSocket connections
-	activeConnections int
-	// connectionMutex protects the activeConnections counter
-	connectionMutex sync.Mutex
-)
-
-func GetActiveConnectionCount() int {
-	connectionMutex.Lock()
-	
-	defer connectionMutex.Unlock()
-
-	return activeConnections
-}
-
-func WSHandler(w http.ResponseWriter, r *http.Request) {
-	handler := NewWebSocketHandler(DefaultWebSocketConfig())
-	handler.ServeHTTP(w, r)
-}
-
-type WebSocketHandler struct {
-	config       *WebSocketConfig
-	mouseCtrl    *mouse.Controller
-}
-
-func NewWebSocketHandler(config *WebSocketConfig) *WebSocketHandler {
-	if config == nil {
-		config = DefaultWebSocketConfig()
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := s.allowlist.Load().check(r); err != nil {
+		fmt.Printf("Rejected connection from %s: %v\n", r.RemoteAddr, err)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
 	}
 	
-	return &WebSocketHandler{
-		config:    config,
-		mouseCtrl: mouse.NewController(config.MouseConfig),
+	if s.isClosing() {
+		http.Error(w, "Server is shutting down", http.StatusServiceUnavailable)
+		return
 	}
-}
-
-func (h *WebSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+	
+	conn, err := s.upgrader.Upgrade(w, r, nil)
 
 	if err != nil {
 		fmt.Println("Error upgrading connection:", err)
@@ -74,226 +62,634 @@ func (h *WebSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	defer conn.Close()
+	conn.SetReadLimit(MaxMessageSize)
+
+	session := newSession(conn, r.RemoteAddr, s.config.Verbose)
+	defer session.close()
+	if !s.track(session) {
+		return
+	}
+	defer s.untrack(session)
 
-	connectionMutex.Lock()
-	activeConnections++
-	connectionMutex.Unlock()
+	if s.config.Verbose {
+		fmt.Printf("New connection established from %s (active: %d)\n", 
+			r.RemoteAddr, s.ActiveConnections())
+	}
+	// Pass control on before the session stops sending
+	defer s.control.leave(session)
 	
+	// Nothing stays pressed once the connection is gone, however it ended
+	reason := "connection closed"
 	defer func() {
-		connectionMutex.Lock()
-		activeConnections--
-		connectionMutex.Unlock()
+		s.releaseHeld(session, reason)
 	}()
-
-	if h.config.Verbose {
-		fmt.Printf("New connection established from %s (active: %d)\n", 
-			r.RemoteAddr, GetActiveConnectionCount())
+	
+	defer func() {
+		if udp := s.udpListener(); udp != nil && session.udp != nil {
+			udp.unregister(session.udpToken)
+		}
+	}()
+	
+	// Without pairing every connection may send input right away
+	if s.config.Pairing == nil {
+		s.authenticate(session)
 	}
-
+	
+	// Greet the client as soon as it connects. Its format isn't known yet,
+	// so the first message is always text, which every client understands,
+	// binary-only ones included.
+	s.greet(session, nil)
+	
+	// frame is reused by every binary message
+	var frame Frame
+	detected := false
+	
 	for {
 		// Read message from client
-		_, message, err := conn.ReadMessage()
+		messageType, message, err := conn.ReadMessage()
 		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, 
+			if s.isClosing() {
+				reason = "server shutdown"
+			} else if websocket.IsUnexpectedCloseError(err, 
 				websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				fmt.Printf("WebSocket error: %v\n", err)
+				reason = "read error"
 			}
 			break
 		}
+		s.watchHeld(session)
 		
-		messageStr := string(message)
-		
-		// Handle click commands
-		if strings.HasPrefix(messageStr, "click:") {
-			clickType := strings.TrimPrefix(messageStr, "click:")
-			h.mouseCtrl.Click(mouse.ClickType(clickType))
+		// Binary frames carry high-rate motion, they bypass the text and JSON parsers
+		if messageType == websocket.BinaryMessage {
+			if !session.authenticated {
+				s.reportError(session, "", errNotAuthenticated)
+			} else if err := s.checkControl(session); err != nil {
+				s.reportError(session, "", err)
+			} else if err := DecodeFrame(message, &frame); err != nil {
+				s.reportError(session, "", parseError(err))
+			} else if err := s.executeFrame(session, &frame); err != nil {
+				s.reportError(session, "", err)
+			}
 			continue
 		}
 		
-		// Handle left button commands
-		if strings.HasPrefix(messageStr, "leftbutton:") {
-			state := strings.TrimPrefix(messageStr, "leftbutton:")
-			if state == "down" {
-				h.mouseCtrl.SetLeftButton(mouse.Down)
-			} else if state == "up" {
-				h.mouseCtrl.SetLeftButton(mouse.Up)
+		// The first text message decides the format of the whole connection
+		if !detected {
+			session.setFormat(detectFormat(message))
+			if s.config.Verbose {
+				fmt.Printf("Connection from %s uses the %s protocol\n", r.RemoteAddr, session.format)
 			}
-			continue
 		}
 		
-		// Handle right button commands
-		if strings.HasPrefix(messageStr, "rightbutton:") {
-			state := strings.TrimPrefix(messageStr, "rightbutton:")
-			if state == "down" {
-				h.mouseCtrl.SetRightButton(mouse.Down)
-			} else if state == "up" {
-				h.mouseCtrl.SetRightButton(mouse.Up)
+		cmd, err := ParseCommand(session.format, message)
+		
+		// Clients may open with a hello announcing their features, answered
+		// with another hello in their format
+		if !detected {
+			detected = true
+			
+			if err == nil && cmd.Type == CommandHello {
+				if s.config.Verbose {
+					fmt.Printf("Client %q at %s uses features: %s\n",
+						cmd.Client, r.RemoteAddr, strings.Join(cmd.Features, ", "))
+				}
+				s.greet(session, cmd.Features)
+				continue
+			}
+			// JSON clients get a hello in their format before any other reply
+			if session.format == FormatJSON {
+				s.greet(session, nil)
 			}
-			continue
 		}
 		
-		// Handle configuration commands
-		if strings.HasPrefix(messageStr, "config:") {
-			h.handleConfigCommand(strings.TrimPrefix(messageStr, "config:"))
+		if err != nil {
+			s.reportError(session, cmd.ID, err)
 			continue
 		}
 		
-		// Handle stabilization commands
-		if strings.HasPrefix(messageStr, "stabilize:") {
-			h.handleStabilizationCommand(strings.TrimPrefix(messageStr, "stabilize:"))
-			continue
+		if err := s.execute(session, cmd); err != nil {
+			s.reportError(session, cmd.ID, err)
+		} else if cmd.ID != "" && cmd.Type != CommandQuery && cmd.Type != CommandPair &&
+			cmd.Type != CommandAuth && cmd.Type != CommandControl {
+			// Queries, pairing, authentication and control are acknowledged by their answer
+			session.send(Reply{Version: ProtocolVersion, Type: ReplyAck, ID: cmd.ID})
 		}
-		
-		// Handle movement commands
-		coords := strings.Split(messageStr, ",")
-		if len(coords) != 2 {
-			if h.config.Verbose {
-				fmt.Println("Invalid message format. Expected 'deltaX,deltaY', 'click:type', 'leftbutton:state', 'rightbutton:state', 'config:...' or 'stabilize:...'")
-			}
-			continue
+	}
+	
+	if s.config.Verbose {
+		fmt.Printf("Connection closed from %s (active: %d)\n", 
+			r.RemoteAddr, s.ActiveConnections())
+	}
+}
+
+// reportError tells the client a message couldn't be parsed or executed
+func (s *Server) reportError(session *session, id string, err error) {
+	// Clients without control are told once, not for every movement
+	if err == errInputDropped && id == "" {
+		return
+	}
+	if s.config.Verbose {
+		fmt.Println("Input error:", err)
+	}
+	session.send(errorReply(id, err))
+}
+
+// greet sends the session a hello, pointing out the client features the
+// server doesn't support
+func (s *Server) greet(session *session, clientFeatures []string) {
+	hello := s.helloReply(clientFeatures)
+	hello.AuthRequired = !session.authenticated
+	hello.UDP = session.udp
+	session.send(hello)
+}
+
+// helloReply describes the server state and capabilities to a new client,
+// pointing out the client features it doesn't support
+func (s *Server) helloReply(clientFeatures []string) Reply {
+	state := s.mouseCtrl.State()
+	return Reply{
+		Version:      ProtocolVersion,
+		Type:         ReplyHello,
+		Capabilities: s.caps.info(),
+		Unsupported:  s.caps.unsupported(clientFeatures),
+		State: &StateInfo{
+			Speed:         state.SpeedFactor,
+			Bounds:        state.EnforceBounds,
+			Accel:         state.Acceleration,
+			Stabilization: state.Stabilization,
+			Confine:       state.ConfinedDisplay,
+			Displays:      displayInfos(state.Displays),
+			Control:       s.config.ControlPolicy.String(),
+		},
+	}
+}
+
+// displayInfos converts displays for replies
+func displayInfos(displays []mouse.Rect) []DisplayInfo {
+	infos := make([]DisplayInfo, len(displays))
+	for i, display := range displays {
+		infos[i] = DisplayInfo{X: display.X, Y: display.Y, Width: display.Width, Height: display.Height}
+	}
+	return infos
+}
+
+// execute runs a command on the controllers
+func (s *Server) execute(session *session, cmd Command) error {
+	switch cmd.Type {
+	case CommandPair, CommandAuth:
+		return s.handleAuthCommand(session, cmd)
+	}
+	if !session.authenticated {
+		return errNotAuthenticated
+	}
+	
+	switch cmd.Type {
+	case CommandControl:
+		return s.handleControlCommand(session, cmd.Action)
+	case CommandQuery, CommandHello:
+	default:
+		if err := s.checkControl(session); err != nil {
+			return err
 		}
+	}
+	
+	if err := s.caps.check(cmd); err != nil {
+		return err
+	}
+	
+	switch cmd.Type {
+	case CommandMove:
+		return s.mouseCtrl.MoveWith(session.stabilizer, cmd.DX, cmd.DY)
+	case CommandClick:
+		return s.handleClickCommand(cmd.Button, cmd.Double)
+	case CommandButton:
+		return s.handleButtonCommand(session, cmd.Button, cmd.State)
+	case CommandScroll:
+		return s.mouseCtrl.Scroll(cmd.DX, cmd.DY)
+	case CommandKey, CommandKeyDown, CommandKeyUp:
+		return s.handleKeyCommand(session, cmd.Type, cmd.Key)
+	case CommandType:
+		if length := utf8.RuneCountInString(cmd.Text); length > MaxTextLength {
+			return validationError(fmt.Errorf("text is %d characters long, the limit is %d", length, MaxTextLength))
+		}
+		return s.keyCtrl.Type(cmd.Text)
+	case CommandHello:
+		return validationError(errors.New("hello must be the first message of the connection"))
+	case CommandConfig:
+		return s.handleConfigCommand(cmd)
+	case CommandStabilize:
+		return s.handleStabilizationCommand(cmd)
+	case CommandQuery:
+		return s.handleQueryCommand(session, cmd)
+	}
+	return validationError(fmt.Errorf("unknown command type: %s", cmd.Type))
+}
+
+// errNotAuthenticated rejects input sent before pairing or authenticating
+var errNotAuthenticated = unauthorizedError(errors.New("pair or authenticate before sending input"))
 
-		deltaX, err := strconv.Atoi(coords[0])
+// handleAuthCommand pairs the device or checks its token, then accepts
+// input from the session
+func (s *Server) handleAuthCommand(session *session, cmd Command) error {
+	if s.config.Pairing == nil {
+		return unsupportedError(errors.New("pairing is disabled on this server"))
+	}
+	if session.authenticated {
+		return validationError(errors.New("the connection is already authenticated"))
+	}
+	
+	reply := Reply{Version: ProtocolVersion, ID: cmd.ID}
+	if cmd.Type == CommandPair {
+		token, err := s.config.Pairing.Pair(cmd.PIN, cmd.Client)
 		if err != nil {
-			if h.config.Verbose {
-				fmt.Println("Invalid x delta coordinate:", err)
-			}
-			continue
+			return unauthorizedError(err)
 		}
-
-		deltaY, err := strconv.Atoi(coords[1])
+		session.device = cmd.Client
+		reply.Type, reply.Token = ReplyPaired, token
+	} else {
+		device, err := s.config.Pairing.Authenticate(cmd.Token)
 		if err != nil {
-			if h.config.Verbose {
-				fmt.Println("Invalid y delta coordinate:", err)
-			}
-			continue
+			return unauthorizedError(err)
 		}
-
-		h.mouseCtrl.Move(deltaX, deltaY)
+		session.device = device.Name
+		reply.Type = ReplyAuthenticated
 	}
 	
-	if h.config.Verbose {
-		fmt.Printf("Connection closed from %s (active: %d)\n", 
-			r.RemoteAddr, GetActiveConnectionCount())
+	s.authenticate(session)
+	if s.config.Verbose {
+		fmt.Printf("Connection from %s authenticated as %q\n", session.remoteAddr, session.device)
 	}
+	
+	reply.UDP = session.udp
+	session.send(reply)
+	return nil
 }
 
-func (h *WebSocketHandler) handleConfigCommand(configCmd string) {
-	parts := strings.Split(configCmd, "=")
-	if len(parts) != 2 {
-		if h.config.Verbose {
-			fmt.Println("Invalid config command format. Expected 'key=value'")
-		}
+// authenticate accepts input from the session, including its movement
+// datagrams when the UDP listener is running
+func (s *Server) authenticate(session *session) {
+	session.authenticated = true
+	
+	listener := s.udpListener()
+	if listener == nil {
 		return
 	}
 	
-	key := parts[0]
-	value := parts[1]
+	udp, token, err := listener.register(session)
+	if err != nil {
+		fmt.Println("Error registering UDP session:", err)
+		return
+	}
+	session.udp, session.udpToken = udp, token
+}
+
+// checkControl rejects input from sessions without control
+func (s *Server) checkControl(session *session) error {
+	if s.control.acquire(session) {
+		return nil
+	}
+	if session.inputRejected.Swap(true) {
+		return errInputDropped
+	}
+	return errNotInControl
+}
+
+// handleControlCommand requests or releases control, or answers a request
+// as the owner
+func (s *Server) handleControlCommand(session *session, action string) error {
+	switch action {
+	case ControlActionRequest:
+		s.control.request(session)
+	case ControlActionRelease:
+		s.control.release(session)
+	case ControlActionGrant, ControlActionDeny:
+		return s.control.answer(session, action == ControlActionGrant)
+	default:
+		return validationError(fmt.Errorf("invalid control action: %s. Expected 'request', 'release', 'grant' or 'deny'", action))
+	}
 	
-	switch key {
-	case "speed":
-		if speed, err := strconv.ParseFloat(value, 64); err == nil {
-			newConfig := &mouse.Config{}
-			newConfig.SpeedFactor = speed
-			
-			h.mouseCtrl.UpdateConfig(newConfig)
-			if h.config.Verbose {
-				fmt.Printf("Mouse speed set to %.2f\n", speed)
-			}
+	if s.config.Verbose {
+		fmt.Printf("Control %s from %s\n", action, session.name())
+	}
+	return nil
+}
+
+// executeFrame runs a binary frame of the session on the mouse controller
+func (s *Server) executeFrame(session *session, frame *Frame) error {
+	switch frame.Type {
+	case FrameMove:
+		return s.mouseCtrl.MoveWith(session.stabilizer, float64(frame.DX), float64(frame.DY))
+	case FrameButton:
+		button := mouse.Button(frame.Button)
+		if err := s.caps.checkButton(button); err != nil {
+			return err
 		}
-	case "bounds":
-		if bounds, err := strconv.ParseBool(value); err == nil {
-			newConfig := &mouse.Config{}
-			
-			newConfig.EnforceBounds = bounds
-			
-			h.mouseCtrl.UpdateConfig(newConfig)
-			if h.config.Verbose {
-				fmt.Printf("Enforce bounds set to %v\n", bounds)
-			}
+		
+		switch frame.State {
+		case 1:
+			return s.setButton(session, button, true)
+		case 0:
+			return s.setButton(session, button, false)
 		}
-	case "silent":
-		if silent, err := strconv.ParseBool(value); err == nil {
-			newConfig := &mouse.Config{}
-			
-			newConfig.Silent = silent
-			
-			h.mouseCtrl.UpdateConfig(newConfig)
-			if h.config.Verbose {
-				fmt.Printf("Silent mode set to %v\n", silent)
-			}
+		return validationError(fmt.Errorf("invalid button state in binary frame: %d", frame.State))
+	case FrameScroll:
+		if err := s.caps.check(Command{Type: CommandScroll}); err != nil {
+			return err
 		}
-	default:
-		if h.config.Verbose {
-			fmt.Printf("Unknown config key: %s\n", key)
+		return s.mouseCtrl.Scroll(float64(frame.DX), float64(frame.DY))
+	}
+	return validationError(fmt.Errorf("unknown binary frame type: %d", frame.Type))
+}
+
+// handleClickCommand clicks the named button, or double clicks it
+func (s *Server) handleClickCommand(name string, double bool) error {
+	button, err := mouse.ParseButton(name)
+	if err != nil {
+		return validationError(err)
+	}
+	if err := s.caps.checkButton(button); err != nil {
+		return err
+	}
+	
+	if double {
+		return s.mouseCtrl.DoubleClickButton(button)
+	}
+	return s.mouseCtrl.ClickButton(button)
+}
+
+// handleButtonCommand presses or releases the named button
+func (s *Server) handleButtonCommand(session *session, name, state string) error {
+	button, err := mouse.ParseButton(name)
+	if err != nil {
+		return validationError(err)
+	}
+	if err := s.caps.checkButton(button); err != nil {
+		return err
+	}
+	
+	switch state {
+	case "down":
+		return s.setButton(session, button, true)
+	case "up":
+		return s.setButton(session, button, false)
+	}
+	return validationError(fmt.Errorf("invalid button state: %s. Expected 'down' or 'up'", state))
+}
+
+// handleKeyCommand taps a key combination ("key:ctrl+shift+t")
+// or presses or releases a single key ("keydown:shift", "keyup:shift")
+func (s *Server) handleKeyCommand(session *session, command, arg string) error {
+	if command == CommandKey {
+		keys, err := keyboard.ParseCombo(arg)
+		if err != nil {
+			return validationError(err)
 		}
+		return s.keyCtrl.Tap(keys...)
 	}
+	
+	key, err := keyboard.ParseKey(arg)
+	if err != nil {
+		return validationError(err)
+	}
+	
+	return s.setKey(session, key, command == CommandKeyDown)
 }
 
-// handleStabilizationCommand processes stabilization commands from the client
-func (h *WebSocketHandler) handleStabilizationCommand(cmd string) {
-	parts := strings.Split(cmd, "=")
-	if len(parts) != 2 {
-		if h.config.Verbose {
-			fmt.Println("Invalid stabilization command format. Expected 'key=value'")
+// setButton presses or releases a button, remembering what the session
+// holds
+func (s *Server) setButton(session *session, button mouse.Button, down bool) error {
+	state := mouse.Up
+	if down {
+		state = mouse.Down
+	}
+	if err := s.mouseCtrl.SetButton(button, state); err != nil {
+		return err
+	}
+	
+	session.held.setButton(button, down)
+	s.watchHeld(session)
+	return nil
+}
+
+// setKey presses or releases a key, remembering what the session holds
+func (s *Server) setKey(session *session, key keyboard.Key, down bool) error {
+	var err error
+	if down {
+		err = s.keyCtrl.KeyDown(key)
+	} else {
+		err = s.keyCtrl.KeyUp(key)
+	}
+	if err != nil {
+		return err
+	}
+	
+	session.held.setKey(key, down)
+	s.watchHeld(session)
+	return nil
+}
+
+// watchHeld restarts the session's idle timer, which releases what it
+// holds once it stops sending
+func (s *Server) watchHeld(session *session) {
+	if timeout := time.Duration(s.idleTimeout.Load()); timeout > 0 {
+		session.held.watch(timeout, func() {
+			s.releaseHeld(session, "idle")
+		})
+	}
+}
+
+// releaseHeld releases every button and key the session still holds
+func (s *Server) releaseHeld(session *session, reason string) {
+	buttons, keys := session.held.take()
+	
+	for _, button := range buttons {
+		if err := s.mouseCtrl.SetButton(button, mouse.Up); err != nil {
+			fmt.Printf("Error releasing %s button of %s: %v\n", button, session.name(), err)
+		} else if s.config.Verbose {
+			fmt.Printf("Released %s button held by %s (%s)\n", button, session.name(), reason)
+		}
+	}
+	for _, key := range keys {
+		if err := s.keyCtrl.KeyUp(key); err != nil {
+			fmt.Printf("Error releasing key %s of %s: %v\n", key, session.name(), err)
+		} else if s.config.Verbose {
+			fmt.Printf("Released key %s held by %s (%s)\n", key, session.name(), reason)
 		}
-		return
 	}
+}
+
+// invalidValue is returned for a setting whose value can't be parsed
+func invalidValue(key, value string) error {
+	return validationError(fmt.Errorf("invalid value for %s: %q", key, value))
+}
+
+// handleConfigCommand applies the settings of a config command. They are
+// applied together: if one of them is invalid, none is.
+func (s *Server) handleConfigCommand(cmd Command) error {
+	var patch mouse.ConfigPatch
+	// confine is the display to keep the pointer on, -1 releases it
+	confine, confined := -1, false
 	
-	key := parts[0]
-	value := parts[1]
+	for _, key := range cmd.SettingKeys() {
+		value, err := cmd.Setting(key)
+		if err != nil {
+			return validationError(err)
+		}
+		
+		switch key {
+		case "speed":
+			speed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return invalidValue(key, value)
+			}
+			patch.SpeedFactor = &speed
+		case "bounds":
+			bounds, err := strconv.ParseBool(value)
+			if err != nil {
+				return invalidValue(key, value)
+			}
+			patch.EnforceBounds = &bounds
+		case "silent":
+			silent, err := strconv.ParseBool(value)
+			if err != nil {
+				return invalidValue(key, value)
+			}
+			patch.Silent = &silent
+		case "confine":
+			// "off", "none" or -1 releases the pointer, otherwise the display index
+			confine, confined = -1, true
+			if value != "off" && value != "none" {
+				if confine, err = strconv.Atoi(value); err != nil || confine < -1 {
+					return invalidValue(key, value)
+				}
+			}
+		case "accel":
+			profile, err := mouse.ParseAccelProfile(value)
+			if err != nil {
+				return validationError(err)
+			}
+			patch.Acceleration = profile
+		default:
+			return validationError(fmt.Errorf("unknown config key: %s", key))
+		}
+	}
 	
-	stabOptions := h.config.MouseConfig.Stabilization
-	if stabOptions == nil {
-		stabOptions = mouse.DefaultStabilizationOptions()
+	if err := patch.Validate(); err != nil {
+		return validationError(err)
+	}
+	// Confining is the only change left that can fail, so it goes first
+	if confined {
+		if err := s.mouseCtrl.ConfineToDisplay(confine); err != nil {
+			if errors.Is(err, mouse.ErrNoDisplay) {
+				return validationError(err)
+			}
+			return err
+		}
+	}
+	if err := s.mouseCtrl.UpdateConfig(patch); err != nil {
+		return validationError(err)
 	}
 	
-	switch key {
-	case "deadzone":
-		if val, err := strconv.Atoi(value); err == nil {
+	if s.config.Verbose {
+		if patch.SpeedFactor != nil {
+			fmt.Printf("Mouse speed set to %.2f\n", *patch.SpeedFactor)
+		}
+		if patch.EnforceBounds != nil {
+			fmt.Printf("Enforce bounds set to %v\n", *patch.EnforceBounds)
+		}
+		if patch.Silent != nil {
+			fmt.Printf("Silent mode set to %v\n", *patch.Silent)
+		}
+		if patch.Acceleration != nil {
+			fmt.Printf("Acceleration set to %s\n", mouse.FormatAccelProfile(patch.Acceleration))
+		}
+	}
+	return nil
+}
+
+// handleQueryCommand answers a query from the client.
+// "displays" lists every display of the desktop, primary first.
+func (s *Server) handleQueryCommand(session *session, cmd Command) error {
+	switch cmd.Query {
+	case "displays":
+		session.send(Reply{
+			Version:  ProtocolVersion,
+			Type:     ReplyDisplays,
+			ID:       cmd.ID,
+			Displays: displayInfos(s.mouseCtrl.RefreshDisplays()),
+		})
+		return nil
+	}
+	return validationError(fmt.Errorf("unknown query: %s", cmd.Query))
+}
+
+// handleStabilizationCommand applies the settings of a stabilize command.
+// They are applied together: moves see either the old settings or all of
+// the new ones.
+func (s *Server) handleStabilizationCommand(cmd Command) error {
+	s.stabilizationMu.Lock()
+	defer s.stabilizationMu.Unlock()
+	
+	// Settings changed while stabilization is disabled apply once enabled
+	stabOptions := s.stabilization
+	enabled := s.mouseCtrl.Stabilization() != nil
+	
+	for _, key := range cmd.SettingKeys() {
+		value, err := cmd.Setting(key)
+		if err != nil {
+			return validationError(err)
+		}
+		
+		switch key {
+		case "deadzone":
+			val, err := strconv.Atoi(value)
+			if err != nil {
+				return invalidValue(key, value)
+			}
 			stabOptions.DeadZone = val
-			if h.config.Verbose {
-				fmt.Printf("Dead zone set to %d\n", val)
+		case "smoothing":
+			val, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return invalidValue(key, value)
 			}
-		}
-	case "smoothing":
-		if val, err := strconv.ParseFloat(value, 64); err == nil {
 			stabOptions.SmoothingLevel = val
-			if h.config.Verbose {
-				fmt.Printf("Smoothing level set to %.2f\n", val)
+		case "jiggle":
+			val, err := strconv.ParseBool(value)
+			if err != nil {
+				return invalidValue(key, value)
 			}
-		}
-	case "jiggle":
-		if val, err := strconv.ParseBool(value); err == nil {
 			stabOptions.JiggleFilter = val
-			if h.config.Verbose {
-				fmt.Printf("Jiggle filter set to %v\n", val)
+		case "drift":
+			val, err := strconv.ParseBool(value)
+			if err != nil {
+				return invalidValue(key, value)
 			}
-		}
-	case "drift":
-		if val, err := strconv.ParseBool(value); err == nil {
 			stabOptions.AntiDrift = val
-			if h.config.Verbose {
-				fmt.Printf("Anti-drift set to %v\n", val)
+		case "enable":
+			val, err := strconv.ParseBool(value)
+			if err != nil {
+				return invalidValue(key, value)
 			}
+			enabled = val
+		default:
+			return validationError(fmt.Errorf("unknown stabilization key: %s", key))
 		}
-	case "enable":
-		if val, err := strconv.ParseBool(value); err == nil {
-			if val {
-				h.mouseCtrl.UpdateStabilization(stabOptions)
-				if h.config.Verbose {
-					fmt.Println("Stabilization enabled")
-				}
-			} else {
-				h.mouseCtrl.UpdateStabilization(nil)
-				if h.config.Verbose {
-					fmt.Println("Stabilization disabled")
-				}
-			}
-		}
-	default:
-		if h.config.Verbose {
-			fmt.Printf("Unknown stabilization key: %s\n", key)
-		}
 	}
-} 
\ No newline at end of file
+	
+	if err := stabOptions.Validate(); err != nil {
+		return validationError(err)
+	}
+	
+	s.stabilization = stabOptions
+	if enabled {
+		s.mouseCtrl.UpdateStabilization(&stabOptions)
+	} else {
+		s.mouseCtrl.UpdateStabilization(nil)
+	}
+	
+	if s.config.Verbose {
+		fmt.Printf("Stabilization enabled: %v, dead zone: %d, smoothing: %.2f, jiggle filter: %v, anti-drift: %v\n",
+			enabled, stabOptions.DeadZone, stabOptions.SmoothingLevel, stabOptions.JiggleFilter, stabOptions.AntiDrift)
+	}
+	return nil
+}
@@ -0,0 +1,344 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/tommyalmeida/remote-mouse/mouse/native"
+)
+
+// newTestServer serves a Server injecting into a virtual 1920x1080 screen,
+// without pairing, logging or stabilization
+func newTestServer(t testing.TB) (*Server, *native.Virtual, string) {
+	t.Helper()
+
+	virtual := native.NewVirtual(1920, 1080)
+	srv, url := serveBackend(t, virtual)
+	return srv, virtual, url
+}
+
+// serveBackend serves a Server injecting through backend, without
+// pairing, logging or stabilization
+func serveBackend(t testing.TB, backend native.Backend) (*Server, string) {
+	t.Helper()
+
+	config := testConfig()
+	config.Backend = backend
+	return serveConfig(t, config)
+}
+
+// testConfig returns a config without pairing, logging or stabilization
+func testConfig() *WebSocketConfig {
+	config := DefaultWebSocketConfig()
+	config.Verbose = false
+	config.MouseConfig.Silent = true
+	config.MouseConfig.Stabilization = nil
+	config.KeyboardConfig.Silent = true
+	config.KeyboardConfig.TypingDelay = 0
+	return config
+}
+
+// serveConfig serves a Server with the given config
+func serveConfig(t testing.TB, config *WebSocketConfig) (*Server, string) {
+	t.Helper()
+
+	srv := NewServer(config)
+	httpServer := httptest.NewServer(srv)
+	t.Cleanup(func() {
+		srv.Close()
+		httpServer.Close()
+	})
+
+	return srv, "ws" + strings.TrimPrefix(httpServer.URL, "http")
+}
+
+// dial opens a connection to the test server
+func dial(t testing.TB, url string) *websocket.Conn {
+	t.Helper()
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// hangUp closes the connection and waits until the server finished
+// handling it, so every message it sent has been executed
+func hangUp(t *testing.T, srv *Server, conn *websocket.Conn) {
+	t.Helper()
+
+	conn.Close()
+	for deadline := time.Now().Add(5 * time.Second); srv.ActiveConnections() > 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("server didn't finish the connection")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// frame encodes a binary frame
+func frame(frameType byte, button, state byte, dx, dy float32) []byte {
+	data := make([]byte, FrameSize)
+	EncodeFrame(data, &Frame{Type: frameType, Button: button, State: state, DX: dx, DY: dy})
+	return data
+}
+
+func TestCommandEvents(t *testing.T) {
+	type message struct {
+		binary bool
+		data   []byte
+	}
+	text := func(s string) message { return message{data: []byte(s)} }
+	binary := func(data []byte) message { return message{binary: true, data: data} }
+
+	tests := []struct {
+		name     string
+		messages []message
+		want     []string
+	}{
+		{
+			name:     "text move",
+			messages: []message{text("10,-5"), text("0.5,0.5"), text("0.5,0.5")},
+			want:     []string{"move 970,535", "move 971,536"},
+		},
+		{
+			name:     "text click",
+			messages: []message{text("click:right"), text("click:double")},
+			want:     []string{"down right", "up right", "down left", "up left", "down left", "up left"},
+		},
+		{
+			name:     "text drag",
+			messages: []message{text("leftbutton:down"), text("5,0"), text("leftbutton:up")},
+			want:     []string{"down left", "move 965,540", "up left"},
+		},
+		{
+			name:     "text keyboard",
+			messages: []message{text("key:ctrl+c"), text("type:hi")},
+			want:     []string{"keydown ctrl", "keydown c", "keyup c", "keyup ctrl", "type 'h'", "type 'i'"},
+		},
+		{
+			name:     "text speed",
+			messages: []message{text("config:speed=2"), text("10,0")},
+			want:     []string{"move 980,540"},
+		},
+		{
+			name: "json",
+			messages: []message{
+				text(`{"v":1,"type":"hello","features":["keyboard"]}`),
+				text(`{"v":1,"type":"move","dx":-20,"dy":10}`),
+				text(`{"v":1,"type":"button","button":"middle","state":"down"}`),
+				text(`{"v":1,"type":"button","button":"middle","state":"up"}`),
+				text(`{"v":1,"type":"scroll","dx":0,"dy":-2}`),
+			},
+			want: []string{"move 940,550", "down middle", "up middle", "scroll 0,-2"},
+		},
+		{
+			name: "binary",
+			messages: []message{
+				binary(frame(FrameMove, 0, 0, 3, 4)),
+				binary(frame(FrameButton, 1, 1, 0, 0)),
+				binary(frame(FrameButton, 1, 0, 0, 0)),
+				binary(frame(FrameScroll, 0, 0, 1, 0)),
+			},
+			want: []string{"move 963,544", "down right", "up right", "scroll 1,0"},
+		},
+		{
+			name:     "held button released on disconnect",
+			messages: []message{text("leftbutton:down"), text("keydown:shift")},
+			want:     []string{"down left", "keydown shift", "up left", "keyup shift"},
+		},
+		{
+			name:     "invalid messages are ignored",
+			messages: []message{text("bogus:1"), text("config:speed=-1"), binary([]byte{1, 2}), text("1,1")},
+			want:     []string{"move 961,541"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv, virtual, url := newTestServer(t)
+			conn := dial(t, url)
+
+			for _, message := range test.messages {
+				messageType := websocket.TextMessage
+				if message.binary {
+					messageType = websocket.BinaryMessage
+				}
+				if err := conn.WriteMessage(messageType, message.data); err != nil {
+					t.Fatalf("write: %v", err)
+				}
+			}
+			hangUp(t, srv, conn)
+
+			var got []string
+			for _, event := range virtual.Events() {
+				got = append(got, event.String())
+			}
+			if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+				t.Errorf("events:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(test.want, "\n"))
+			}
+		})
+	}
+}
+
+// isNotice reports whether a message is a hello or control notice, in
+// the text or the JSON format
+func isNotice(message string) bool {
+	for _, prefix := range []string{"hello:", "control:", `{"v":1,"type":"hello"`, `{"v":1,"type":"control"`} {
+		if strings.HasPrefix(message, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// readReplies reads n messages, skipping the hello and control notices
+func readReplies(t *testing.T, conn *websocket.Conn, n int) []string {
+	t.Helper()
+
+	var replies []string
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for len(replies) < n {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		if !isNotice(string(message)) {
+			replies = append(replies, string(message))
+		}
+	}
+	return replies
+}
+
+func TestConfine(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{value: "-2", want: "error:validation:invalid value for confine: \"-2\""},
+		{value: "x", want: "error:validation:invalid value for confine: \"x\""},
+		{value: "1", want: "error:validation:no display 1, there are 1"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			_, _, url := newTestServer(t)
+			conn := dial(t, url)
+
+			conn.WriteMessage(websocket.TextMessage, []byte("config:confine="+test.value))
+			if got := readReplies(t, conn, 1)[0]; got != test.want {
+				t.Errorf("reply %q, want %q", got, test.want)
+			}
+		})
+	}
+
+	// Releasing is valid in every spelling, the reply is the error of the
+	// message after them
+	srv, _, url := newTestServer(t)
+	conn := dial(t, url)
+	for _, value := range []string{"0", "off", "none", "-1"} {
+		conn.WriteMessage(websocket.TextMessage, []byte("config:confine="+value))
+	}
+	conn.WriteMessage(websocket.TextMessage, []byte("config:confine=-3"))
+	if got := readReplies(t, conn, 1)[0]; !strings.Contains(got, `"-3"`) {
+		t.Errorf("reply %q, want the error of -3", got)
+	}
+	if state := srv.mouseCtrl.State(); state.ConfinedDisplay != -1 {
+		t.Errorf("confined to %d, want -1", state.ConfinedDisplay)
+	}
+}
+
+func TestGreeting(t *testing.T) {
+	_, _, url := newTestServer(t)
+
+	// Clients are greeted before they send anything
+	conn := dial(t, url)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, message, err := conn.ReadMessage(); err != nil || !strings.HasPrefix(string(message), "hello:v=1;") {
+		t.Fatalf("greeting %q, %v", message, err)
+	}
+
+	// A hello is answered in the client's format
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"v":1,"type":"hello","features":["keyboard","teleport"]}`))
+	_, message, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reply Reply
+	if err := json.Unmarshal(message, &reply); err != nil || reply.Type != ReplyHello {
+		t.Fatalf("reply %s, %v", message, err)
+	}
+	if len(reply.Unsupported) != 1 || reply.Unsupported[0] != "teleport" {
+		t.Errorf("unsupported %v, want [teleport]", reply.Unsupported)
+	}
+
+	// JSON clients starting with another message get a JSON hello first
+	conn = dial(t, url)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"v":1,"type":"query","query":"displays"}`))
+	var types []string
+	for len(types) < 3 {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.HasPrefix(string(message), "hello:") {
+			types = append(types, "text hello")
+		} else if err := json.Unmarshal(message, &reply); err != nil {
+			t.Fatalf("reply %s, %v", message, err)
+		} else if reply.Type != ReplyControl {
+			types = append(types, reply.Type)
+		}
+	}
+	if got := strings.Join(types, ", "); got != "text hello, hello, displays" {
+		t.Errorf("replies %s, want text hello, hello, displays", got)
+	}
+}
+
+func TestConfigAppliesAllOrNothing(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings string
+		speed    float64
+		err      bool
+	}{
+		{name: "valid", settings: `{"speed":2,"bounds":false,"accel":"power"}`, speed: 2},
+		{name: "invalid value", settings: `{"speed":2,"bounds":"maybe"}`, speed: 1, err: true},
+		{name: "out of range", settings: `{"bounds":false,"speed":-2}`, speed: 1, err: true},
+		{name: "no such display", settings: `{"speed":2,"confine":3}`, speed: 1, err: true},
+		{name: "unknown key", settings: `{"speed":2,"turbo":true}`, speed: 1, err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv, _, url := newTestServer(t)
+			conn := dial(t, url)
+
+			conn.WriteMessage(websocket.TextMessage, []byte(`{"v":1,"type":"config","id":"1","settings":`+test.settings+`}`))
+			var reply Reply
+			if err := json.Unmarshal([]byte(readReplies(t, conn, 1)[0]), &reply); err != nil {
+				t.Fatal(err)
+			}
+			if (reply.Type == ReplyError) != test.err {
+				t.Fatalf("reply %+v, want error %v", reply, test.err)
+			}
+
+			state := srv.mouseCtrl.State()
+			if state.SpeedFactor != test.speed {
+				t.Errorf("speed %g, want %g", state.SpeedFactor, test.speed)
+			}
+			if state.EnforceBounds != test.err {
+				t.Errorf("bounds %v, want %v", state.EnforceBounds, test.err)
+			}
+			if wantAccel := !test.err; (state.Acceleration != "linear") != wantAccel {
+				t.Errorf("acceleration %s", state.Acceleration)
+			}
+		})
+	}
+}